@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+)
+
+var (
+	signerCacheMu sync.Mutex
+	signerCache   = map[string]ssh.Signer{}
+)
+
+// loadSigner parses the private key at path, decrypting it with a
+// passphrase read from the controlling TTY if needed. Decrypted signers are
+// cached per path so a multi-host run only prompts once per key.
+func loadSigner(path string) (ssh.Signer, error) {
+	signerCacheMu.Lock()
+	if s, ok := signerCache[path]; ok {
+		signerCacheMu.Unlock()
+		return s, nil
+	}
+	signerCacheMu.Unlock()
+
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if _, encrypted := err.(*ssh.PassphraseMissingError); encrypted {
+		passphrase, askErr := askSecret(fmt.Sprintf("Enter passphrase for key %s: ", path))
+		if askErr != nil {
+			return nil, fmt.Errorf("failed to read passphrase for %s: %w", path, askErr)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+	}
+
+	signerCacheMu.Lock()
+	signerCache[path] = signer
+	signerCacheMu.Unlock()
+	return signer, nil
+}
+
+// askSecret prompts on the controlling TTY with echo disabled, restoring
+// terminal state if the process is interrupted mid-prompt.
+func askSecret(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no controlling TTY available to prompt: %w", err)
+	}
+	defer tty.Close()
+
+	fd := int(tty.Fd())
+	oldState, err := term.GetState(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigCh:
+			term.Restore(fd, oldState)
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	defer func() {
+		signal.Stop(sigCh)
+		close(done)
+	}()
+
+	fmt.Fprint(tty, prompt)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// agentAuthMethod connects to the running ssh-agent via SSH_AUTH_SOCK and
+// returns an AuthMethod backed by it, or nil if no agent is available.
+func agentAuthMethod() ssh.AuthMethod {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil
+	}
+	ag := agent.NewClient(conn)
+	return ssh.PublicKeysCallback(ag.Signers)
+}
+
+// parseAuthOrder parses a --auth-order=agent,key,password value into an
+// ordered, de-duplicated list, defaulting to agent,key when empty.
+func parseAuthOrder(spec string) ([]string, error) {
+	if spec == "" {
+		return []string{"agent", "key"}, nil
+	}
+	var order []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		switch part {
+		case "agent", "key", "password":
+		default:
+			return nil, fmt.Errorf("unknown --auth-order entry %q (want agent, key, or password)", part)
+		}
+		if !seen[part] {
+			order = append(order, part)
+			seen[part] = true
+		}
+	}
+	return order, nil
+}
+
+// authMethodsFor builds the ssh.AuthMethod list for hc in the order given by
+// hc.AuthOrder, skipping methods that aren't available (e.g. no agent
+// running) rather than failing outright.
+func authMethodsFor(hc HostConfig) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	for _, kind := range hc.AuthOrder {
+		switch kind {
+		case "agent":
+			if m := agentAuthMethod(); m != nil {
+				methods = append(methods, m)
+			}
+		case "key":
+			var signers []ssh.Signer
+			for _, path := range hc.IdentityPaths {
+				signer, err := loadSigner(path)
+				if err != nil {
+					logger.Warn("skipping identity, failed to load", "path", path, "err", err)
+					continue
+				}
+				signers = append(signers, signer)
+			}
+			if len(signers) > 0 {
+				methods = append(methods, ssh.PublicKeys(signers...))
+			}
+		case "password":
+			methods = append(methods, ssh.PasswordCallback(func() (string, error) {
+				secret, err := askSecret(fmt.Sprintf("Password for %s@%s: ", hc.User, hc.Hostname))
+				return string(secret), err
+			}))
+		}
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no usable SSH auth methods for host %s (tried: %s)", hc.Hostname, strings.Join(hc.AuthOrder, ","))
+	}
+	return methods, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseAuthOrder(t *testing.T) {
+	t.Run("empty spec defaults to agent,key", func(t *testing.T) {
+		order, err := parseAuthOrder("")
+		if err != nil {
+			t.Fatalf("parseAuthOrder(\"\") returned error: %v", err)
+		}
+		want := []string{"agent", "key"}
+		if len(order) != len(want) || order[0] != want[0] || order[1] != want[1] {
+			t.Errorf("order = %v, want %v", order, want)
+		}
+	})
+
+	t.Run("parses and de-duplicates, preserving first occurrence order", func(t *testing.T) {
+		order, err := parseAuthOrder("key, password,key,agent")
+		if err != nil {
+			t.Fatalf("parseAuthOrder returned error: %v", err)
+		}
+		want := []string{"key", "password", "agent"}
+		if len(order) != len(want) {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+		for i := range want {
+			if order[i] != want[i] {
+				t.Errorf("order[%d] = %q, want %q", i, order[i], want[i])
+			}
+		}
+	})
+
+	t.Run("rejects an unknown entry", func(t *testing.T) {
+		if _, err := parseAuthOrder("agent,carrier-pigeon"); err == nil {
+			t.Error("expected an error for an unknown --auth-order entry, got nil")
+		}
+	})
+}
+
+// writeTestPrivateKey writes an unencrypted RSA private key (PEM, PKCS1) to
+// a new file under dir and returns its path. ssh.ParsePrivateKey accepts
+// this format directly, no passphrase prompt involved.
+func writeTestPrivateKey(t *testing.T, dir, name string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("failed to write test key %s: %v", path, err)
+	}
+	return path
+}
+
+func TestAuthMethodsFor(t *testing.T) {
+	// Force the "agent" case to see no agent, regardless of the host running
+	// these tests.
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	t.Run("a bad identity path doesn't prevent a later good one from loading", func(t *testing.T) {
+		goodKey := writeTestPrivateKey(t, t.TempDir(), "good_key")
+		hc := HostConfig{
+			Hostname:      "example.com",
+			AuthOrder:     []string{"key"},
+			IdentityPaths: []string{"/nonexistent/path", goodKey},
+		}
+		methods, err := authMethodsFor(hc)
+		if err != nil {
+			t.Fatalf("authMethodsFor returned error: %v", err)
+		}
+		if len(methods) != 1 {
+			t.Fatalf("got %d methods, want 1 (the good key)", len(methods))
+		}
+	})
+
+	t.Run("every identity path failing to load yields an error, not a panic", func(t *testing.T) {
+		hc := HostConfig{
+			Hostname:      "example.com",
+			AuthOrder:     []string{"key"},
+			IdentityPaths: []string{"/nonexistent/path"},
+		}
+		if _, err := authMethodsFor(hc); err == nil {
+			t.Error("expected an error when no identity loads, got nil")
+		}
+	})
+
+	t.Run("password is still offered even when key and agent are unavailable", func(t *testing.T) {
+		hc := HostConfig{
+			Hostname:      "example.com",
+			AuthOrder:     []string{"agent", "key", "password"},
+			IdentityPaths: []string{"/nonexistent/path"},
+		}
+		methods, err := authMethodsFor(hc)
+		if err != nil {
+			t.Fatalf("authMethodsFor returned error: %v", err)
+		}
+		if len(methods) != 1 {
+			t.Fatalf("got %d methods, want 1 (password)", len(methods))
+		}
+	})
+
+	t.Run("no auth methods available at all is an error naming the host", func(t *testing.T) {
+		hc := HostConfig{Hostname: "example.com", AuthOrder: []string{"agent", "key"}, IdentityPaths: []string{"/nonexistent/path"}}
+		_, err := authMethodsFor(hc)
+		if err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
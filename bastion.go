@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// parseBastionSpec parses a --bastion value of one or more comma-separated
+// "user@host[:port]" hops, outermost (dialed directly) first, innermost
+// (dials the real target) last. keyPath, if set, is used for every hop;
+// otherwise each hop falls back to target's own private key.
+func parseBastionSpec(spec, keyPath string, target HostConfig) ([]HostConfig, error) {
+	var hops []HostConfig
+	for _, hop := range strings.Split(spec, ",") {
+		hop = strings.TrimSpace(hop)
+		if hop == "" {
+			continue
+		}
+		hc, err := parseBastionHop(hop, keyPath, target)
+		if err != nil {
+			return nil, err
+		}
+		hops = append(hops, hc)
+	}
+	if len(hops) == 0 {
+		return nil, fmt.Errorf("--bastion given with no hops")
+	}
+	return hops, nil
+}
+
+// parseBastionHop parses a single "user@host[:port]" hop, inheriting the
+// target's host-key verification settings and auth preference order so each
+// hop is authenticated the same way as the final destination.
+func parseBastionHop(hop, keyPath string, target HostConfig) (HostConfig, error) {
+	userHost := strings.SplitN(hop, "@", 2)
+	if len(userHost) != 2 {
+		return HostConfig{}, fmt.Errorf("invalid --bastion entry %q, want user@host[:port]", hop)
+	}
+	user, hostPort := userHost[0], userHost[1]
+
+	host, portStr, err := net.SplitHostPort(hostPort)
+	port := 22
+	if err != nil {
+		host = hostPort // no port given; keep the default
+	} else if port, err = strconv.Atoi(portStr); err != nil {
+		return HostConfig{}, fmt.Errorf("invalid port in --bastion entry %q: %w", hop, err)
+	}
+
+	hc := HostConfig{
+		Hostname:              host,
+		User:                  user,
+		Port:                  port,
+		PrivateKeyPath:        keyPath,
+		KnownHostsFile:        target.KnownHostsFile,
+		StrictHostKeyChecking: target.StrictHostKeyChecking,
+		AuthOrder:             target.AuthOrder,
+	}
+	if hc.PrivateKeyPath == "" {
+		hc.PrivateKeyPath = target.PrivateKeyPath
+	}
+	hc.IdentityPaths = []string{hc.PrivateKeyPath}
+	return hc, nil
+}
+
+// dialThroughBastions dials each of bastions in order, chaining every hop's
+// connection through the previous one, and returns an *ssh.Client per hop,
+// outermost first, so the caller can close them all once it's done with the
+// chain. The last element is the innermost bastion; the caller still needs
+// one more Dial from that client to reach the real target. On error, every
+// hop client already dialed is closed (innermost first) before returning.
+func dialThroughBastions(bastions []HostConfig) ([]*ssh.Client, error) {
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+
+	for _, hop := range bastions {
+		hopConfig, err := sshClientConfig(hop)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to build SSH config for bastion %s: %w", hop.Hostname, err)
+		}
+		addr := fmt.Sprintf("%s:%d", hop.Hostname, hop.Port)
+
+		if len(clients) == 0 {
+			client, err := ssh.Dial("tcp", addr, hopConfig)
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("failed to dial bastion %s: %w", hop.Hostname, err)
+			}
+			clients = append(clients, client)
+			continue
+		}
+
+		prev := clients[len(clients)-1]
+		conn, err := prev.Dial("tcp", addr)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to dial bastion %s via previous hop: %w", hop.Hostname, err)
+		}
+		ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, hopConfig)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to establish SSH connection to bastion %s: %w", hop.Hostname, err)
+		}
+		clients = append(clients, ssh.NewClient(ncc, chans, reqs))
+	}
+	return clients, nil
+}
+
+// dialViaBastions dials addr (the real target) through config.Bastions when
+// set, chaining through every hop; otherwise it dials addr directly. The
+// returned bastion clients (outermost first) are only used to reach addr;
+// the caller must close them -- innermost first -- once it's done with the
+// target client, alongside the target client itself.
+func dialViaBastions(config HostConfig, addr string, sshConfig *ssh.ClientConfig) (*ssh.Client, []*ssh.Client, error) {
+	if len(config.Bastions) == 0 {
+		client, err := ssh.Dial("tcp", addr, sshConfig)
+		return client, nil, err
+	}
+
+	hopClients, err := dialThroughBastions(config.Bastions)
+	if err != nil {
+		return nil, nil, err
+	}
+	lastHop := hopClients[len(hopClients)-1]
+
+	conn, err := lastHop.Dial("tcp", addr)
+	if err != nil {
+		closeHopClients(hopClients)
+		return nil, nil, fmt.Errorf("failed to dial target %s via bastion: %w", addr, err)
+	}
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	if err != nil {
+		closeHopClients(hopClients)
+		return nil, nil, fmt.Errorf("failed to establish SSH connection to %s via bastion: %w", addr, err)
+	}
+	return ssh.NewClient(ncc, chans, reqs), hopClients, nil
+}
+
+// closeHopClients closes bastion hop clients innermost first, the reverse of
+// dial order, so each hop's tunnel is torn down before the hop carrying it.
+func closeHopClients(hopClients []*ssh.Client) {
+	for i := len(hopClients) - 1; i >= 0; i-- {
+		hopClients[i].Close()
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestParseBastionHop(t *testing.T) {
+	target := HostConfig{
+		PrivateKeyPath:        "/home/me/.ssh/target_key",
+		KnownHostsFile:        "/home/me/.ssh/known_hosts",
+		StrictHostKeyChecking: "yes",
+		AuthOrder:             []string{"agent", "key"},
+	}
+
+	t.Run("inherits the target's verification and auth settings", func(t *testing.T) {
+		hc, err := parseBastionHop("jump@bastion.example.com", "", target)
+		if err != nil {
+			t.Fatalf("parseBastionHop returned error: %v", err)
+		}
+		if hc.Hostname != "bastion.example.com" || hc.User != "jump" || hc.Port != 22 {
+			t.Errorf("hop = %+v, want host=bastion.example.com user=jump port=22", hc)
+		}
+		if hc.KnownHostsFile != target.KnownHostsFile {
+			t.Errorf("KnownHostsFile = %q, want inherited %q", hc.KnownHostsFile, target.KnownHostsFile)
+		}
+		if hc.StrictHostKeyChecking != target.StrictHostKeyChecking {
+			t.Errorf("StrictHostKeyChecking = %q, want inherited %q", hc.StrictHostKeyChecking, target.StrictHostKeyChecking)
+		}
+		if hc.PrivateKeyPath != target.PrivateKeyPath {
+			t.Errorf("PrivateKeyPath = %q, want fallback to target's %q", hc.PrivateKeyPath, target.PrivateKeyPath)
+		}
+		if len(hc.IdentityPaths) != 1 || hc.IdentityPaths[0] != hc.PrivateKeyPath {
+			t.Errorf("IdentityPaths = %v, want [%q]", hc.IdentityPaths, hc.PrivateKeyPath)
+		}
+	})
+
+	t.Run("explicit --bastion-key wins over the target's key", func(t *testing.T) {
+		hc, err := parseBastionHop("jump@bastion.example.com:2022", "/home/me/.ssh/bastion_key", target)
+		if err != nil {
+			t.Fatalf("parseBastionHop returned error: %v", err)
+		}
+		if hc.Port != 2022 {
+			t.Errorf("Port = %d, want 2022", hc.Port)
+		}
+		if hc.PrivateKeyPath != "/home/me/.ssh/bastion_key" {
+			t.Errorf("PrivateKeyPath = %q, want explicit bastion key", hc.PrivateKeyPath)
+		}
+	})
+
+	t.Run("rejects a hop without a user", func(t *testing.T) {
+		if _, err := parseBastionHop("bastion.example.com", "", target); err == nil {
+			t.Error("expected an error for a hop missing user@, got nil")
+		}
+	})
+
+	t.Run("rejects an invalid port", func(t *testing.T) {
+		if _, err := parseBastionHop("jump@bastion.example.com:notaport", "", target); err == nil {
+			t.Error("expected an error for an invalid port, got nil")
+		}
+	})
+}
+
+func TestParseBastionSpec(t *testing.T) {
+	target := HostConfig{PrivateKeyPath: "/home/me/.ssh/target_key"}
+
+	hops, err := parseBastionSpec("jump1@first.example.com, jump2@second.example.com:2022", "", target)
+	if err != nil {
+		t.Fatalf("parseBastionSpec returned error: %v", err)
+	}
+	if len(hops) != 2 {
+		t.Fatalf("got %d hops, want 2", len(hops))
+	}
+	if hops[0].Hostname != "first.example.com" || hops[1].Hostname != "second.example.com" {
+		t.Errorf("hops out of order: %+v", hops)
+	}
+	if hops[1].Port != 2022 {
+		t.Errorf("hops[1].Port = %d, want 2022", hops[1].Port)
+	}
+
+	if _, err := parseBastionSpec("", "", target); err == nil {
+		t.Error("expected an error for an empty --bastion spec, got nil")
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Collector gathers one category of system facts (packages, services,
+// network, ...). Several implementations may exist per category, one per
+// supported OS family; fetchData runs whichever ones Detect true.
+type Collector interface {
+	// Name is the category this collector belongs to, and the key its
+	// output is stored under in SystemDetails.Collectors.
+	Name() string
+	// Detect reports whether this collector applies to client's host.
+	Detect(ctx context.Context, client *ssh.Client) bool
+	// Collect gathers and parses this collector's data.
+	Collect(ctx context.Context, client *ssh.Client) (any, error)
+}
+
+// allCollectors lists every known Collector implementation. fetchData
+// filters this down to the ones that Detect true (and are in the
+// --collectors selection, if any) for a given host.
+func allCollectors() []Collector {
+	return []Collector{
+		debianPackageCollector{},
+		rpmPackageCollector{},
+		alpinePackageCollector{},
+		freebsdPackageCollector{},
+		systemdServiceCollector{},
+		openrcServiceCollector{},
+		rcdServiceCollector{},
+		networkCollector{},
+		freebsdNetworkCollector{},
+		modulesCollector{},
+	}
+}
+
+// commandExists reports whether name is on the remote host's PATH.
+func commandExists(ctx context.Context, client *ssh.Client, name string) bool {
+	_, err := executeCommand(ctx, client, fmt.Sprintf("command -v %s", name))
+	return err == nil
+}
+
+// fetchData probes the host's OS family, then runs every selected, detected
+// Collector concurrently over client (each ssh.Session is independent). A
+// collector that fails is logged and simply absent from
+// SystemDetails.Collectors; it doesn't take down the rest of the host's
+// results, since e.g. a Linux-only collector misdetecting on a BSD host
+// shouldn't cost the host its package/service data.
+func fetchData(ctx context.Context, client *ssh.Client, selected []string, hlog *slog.Logger) (*SystemDetails, error) {
+	osFamily, distroID, err := probeOSRelease(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("error probing OS release: %w", err)
+	}
+
+	architecture, err := executeCommand(ctx, client, "uname -m")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching architecture: %w", err)
+	}
+	kernelVersion, err := executeCommand(ctx, client, "uname -r")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching kernel version: %w", err)
+	}
+
+	details := SystemDetails{
+		Timestamp:     time.Now(),
+		OSFamily:      osFamily,
+		DistroID:      distroID,
+		Architecture:  strings.TrimSpace(architecture),
+		KernelVersion: strings.TrimSpace(kernelVersion),
+		Collectors:    make(map[string]any),
+	}
+
+	var active []Collector
+	for _, c := range allCollectors() {
+		if !collectorSelected(c.Name(), selected) {
+			continue
+		}
+		if !c.Detect(ctx, client) {
+			continue
+		}
+		active = append(active, c)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, c := range active {
+		wg.Add(1)
+		go func(c Collector) {
+			defer wg.Done()
+			out, err := c.Collect(ctx, client)
+			if err != nil {
+				hlog.Warn("collector failed, skipping", "collector", c.Name(), "err", err)
+				return
+			}
+			mu.Lock()
+			details.Collectors[c.Name()] = out
+			mu.Unlock()
+		}(c)
+	}
+
+	wg.Wait()
+
+	return &details, nil
+}
+
+// collectorSelected reports whether name is in selected, or selected is
+// empty (meaning "run everything").
+func collectorSelected(name string, selected []string) bool {
+	if len(selected) == 0 {
+		return true
+	}
+	for _, s := range selected {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// probeOSRelease reads /etc/os-release (falling back to uname -s for
+// systems like FreeBSD that don't have one) and classifies the host into a
+// broad os_family used to pick collectors, plus its raw distro_id.
+func probeOSRelease(ctx context.Context, client *ssh.Client) (osFamily, distroID string, err error) {
+	out, err := executeCommand(ctx, client, "cat /etc/os-release 2>/dev/null || true")
+	if err != nil {
+		return "", "", err
+	}
+
+	fields := parseOSRelease(out)
+	id := fields["ID"]
+	idLike := fields["ID_LIKE"]
+
+	switch {
+	case id == "":
+		sysname, err := executeCommand(ctx, client, "uname -s")
+		if err != nil {
+			return "", "", err
+		}
+		sysname = strings.TrimSpace(sysname)
+		if strings.EqualFold(sysname, "FreeBSD") {
+			return "freebsd", "freebsd", nil
+		}
+		return "unknown", strings.ToLower(sysname), nil
+	case id == "alpine":
+		return "alpine", id, nil
+	case id == "debian" || id == "ubuntu" || strings.Contains(idLike, "debian"):
+		return "debian", id, nil
+	case id == "rhel" || id == "fedora" || id == "centos" || strings.Contains(idLike, "rhel") || strings.Contains(idLike, "fedora"):
+		return "rhel", id, nil
+	default:
+		return "unknown", id, nil
+	}
+}
+
+// parseOSRelease parses the KEY=VALUE (optionally quoted) lines from
+// /etc/os-release.
+func parseOSRelease(output string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		fields[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+	return fields
+}
+
+// debianPackageCollector lists packages on Debian/Ubuntu via dpkg.
+type debianPackageCollector struct{}
+
+func (debianPackageCollector) Name() string { return "packages" }
+func (debianPackageCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	return commandExists(ctx, client, "dpkg-query")
+}
+func (debianPackageCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	out, err := executeCommand(ctx, client, "dpkg-query --show")
+	if err != nil {
+		return nil, err
+	}
+	return parseDpkgOutput(out), nil
+}
+
+// rpmPackageCollector lists packages on RHEL/Fedora via rpm.
+type rpmPackageCollector struct{}
+
+func (rpmPackageCollector) Name() string { return "packages" }
+func (rpmPackageCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	return commandExists(ctx, client, "rpm")
+}
+func (rpmPackageCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	out, err := executeCommand(ctx, client, `rpm -qa --queryformat '%{NAME}\t%{VERSION}-%{RELEASE}\n'`)
+	if err != nil {
+		return nil, err
+	}
+	return parseDpkgOutput(out), nil // same "name\tversion" shape as dpkg-query --show
+}
+
+// alpinePackageCollector lists packages on Alpine via apk.
+type alpinePackageCollector struct{}
+
+func (alpinePackageCollector) Name() string { return "packages" }
+func (alpinePackageCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	return commandExists(ctx, client, "apk")
+}
+func (alpinePackageCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	out, err := executeCommand(ctx, client, "apk info -v")
+	if err != nil {
+		return nil, err
+	}
+	return parseApkOutput(out), nil
+}
+
+// parseApkOutput parses the "name-version" lines from `apk info -v`.
+func parseApkOutput(output string) []InstalledLib {
+	var libs []InstalledLib
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// Alpine package/version strings are themselves hyphenated (e.g.
+		// "musl-1.2.4-r2"), so split at the last hyphen that's immediately
+		// followed by a digit.
+		idx := strings.LastIndex(line, "-")
+		for idx > 0 && !(idx+1 < len(line) && line[idx+1] >= '0' && line[idx+1] <= '9') {
+			idx = strings.LastIndex(line[:idx], "-")
+		}
+		if idx <= 0 {
+			continue
+		}
+		libs = append(libs, InstalledLib{Name: line[:idx], Version: line[idx+1:]})
+	}
+	return libs
+}
+
+// freebsdPackageCollector lists packages on FreeBSD via pkg.
+type freebsdPackageCollector struct{}
+
+func (freebsdPackageCollector) Name() string { return "packages" }
+func (freebsdPackageCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	return commandExists(ctx, client, "pkg")
+}
+func (freebsdPackageCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	out, err := executeCommand(ctx, client, `pkg info -a -F '%n\t%v'`)
+	if err != nil {
+		return nil, err
+	}
+	return parseDpkgOutput(out), nil
+}
+
+// systemdServiceCollector lists unit states on systemd hosts.
+type systemdServiceCollector struct{}
+
+func (systemdServiceCollector) Name() string { return "services" }
+func (systemdServiceCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	return commandExists(ctx, client, "systemctl")
+}
+func (systemdServiceCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	out, err := executeCommand(ctx, client, "systemctl list-units --output=export | tail -n +2 | sort")
+	if err != nil {
+		return nil, err
+	}
+	return parseSystemdOutput(out), nil
+}
+
+// openrcServiceCollector lists service states on OpenRC hosts (e.g. Alpine).
+type openrcServiceCollector struct{}
+
+func (openrcServiceCollector) Name() string { return "services" }
+func (openrcServiceCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	return commandExists(ctx, client, "rc-status")
+}
+func (openrcServiceCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	out, err := executeCommand(ctx, client, "rc-status --all 2>/dev/null")
+	if err != nil {
+		return nil, err
+	}
+	return parseOpenRCOutput(out), nil
+}
+
+// parseOpenRCOutput parses "name [ state ]" lines from `rc-status --all`
+// into the same SystemdUnit shape the systemd collector uses.
+func parseOpenRCOutput(output string) []SystemdUnit {
+	var units []SystemdUnit
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "Runlevel:") {
+			continue
+		}
+		open := strings.Index(line, "[")
+		closeIdx := strings.Index(line, "]")
+		if open < 0 || closeIdx < open {
+			continue
+		}
+		name := strings.TrimSpace(line[:open])
+		state := strings.TrimSpace(line[open+1 : closeIdx])
+		units = append(units, SystemdUnit{Name: name, LoadState: "loaded", ActiveState: state})
+	}
+	return units
+}
+
+// rcdServiceCollector lists enabled services on FreeBSD's rc.d.
+type rcdServiceCollector struct{}
+
+func (rcdServiceCollector) Name() string { return "services" }
+func (rcdServiceCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	// "service" also exists as a SysV/systemd compatibility shim on Debian
+	// and friends, so don't trust its presence alone -- require the absence
+	// of systemctl too, the same way systemdServiceCollector and
+	// openrcServiceCollector are mutually exclusive by construction.
+	return commandExists(ctx, client, "service") && !commandExists(ctx, client, "systemctl")
+}
+func (rcdServiceCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	out, err := executeCommand(ctx, client, "service -e")
+	if err != nil {
+		return nil, err
+	}
+	return parseRcdOutput(out), nil
+}
+
+// parseRcdOutput parses the enabled rc.d script paths from `service -e`
+// into the same SystemdUnit shape the systemd collector uses.
+func parseRcdOutput(output string) []SystemdUnit {
+	var units []SystemdUnit
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name := line
+		if idx := strings.LastIndex(line, "/"); idx >= 0 {
+			name = line[idx+1:]
+		}
+		units = append(units, SystemdUnit{Name: name, LoadState: "loaded", ActiveState: "enabled"})
+	}
+	return units
+}
+
+// networkCollector gathers IP addresses, interfaces, and routes on Linux
+// hosts via iproute2 and /sys/class/net; see freebsdNetworkCollector for the
+// BSD equivalent.
+type networkCollector struct{}
+
+func (networkCollector) Name() string { return "network" }
+func (networkCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	return commandExists(ctx, client, "ip")
+}
+func (networkCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	var nc NetworkConfig
+
+	ipOut, err := executeCommand(ctx, client, "hostname -I")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching IP addresses: %w", err)
+	}
+	nc.IPAddresses = strings.Fields(strings.TrimSpace(ipOut))
+
+	ifOut, err := executeCommand(ctx, client, "ls /sys/class/net")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching network interfaces: %w", err)
+	}
+	nc.Interfaces = strings.Fields(strings.TrimSpace(ifOut))
+
+	routeOut, err := executeCommand(ctx, client, "ip route")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching routing information: %w", err)
+	}
+	nc.RoutingInfo = strings.TrimSpace(routeOut)
+
+	return nc, nil
+}
+
+// freebsdNetworkCollector gathers IP addresses, interfaces, and routes on
+// BSD hosts, where none of networkCollector's Linux-only commands (ip,
+// hostname -I, /sys/class/net) exist.
+type freebsdNetworkCollector struct{}
+
+func (freebsdNetworkCollector) Name() string { return "network" }
+func (freebsdNetworkCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	return commandExists(ctx, client, "ifconfig")
+}
+func (freebsdNetworkCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	var nc NetworkConfig
+
+	ifOut, err := executeCommand(ctx, client, "ifconfig -l")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching network interfaces: %w", err)
+	}
+	nc.Interfaces = strings.Fields(strings.TrimSpace(ifOut))
+
+	ipOut, err := executeCommand(ctx, client, `ifconfig | awk '/inet /{print $2}'`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching IP addresses: %w", err)
+	}
+	nc.IPAddresses = strings.Fields(strings.TrimSpace(ipOut))
+
+	routeOut, err := executeCommand(ctx, client, "netstat -rn")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching routing information: %w", err)
+	}
+	nc.RoutingInfo = strings.TrimSpace(routeOut)
+
+	return nc, nil
+}
+
+// modulesCollector lists loaded kernel modules on Linux hosts.
+type modulesCollector struct{}
+
+func (modulesCollector) Name() string { return "modules" }
+func (modulesCollector) Detect(ctx context.Context, client *ssh.Client) bool {
+	return commandExists(ctx, client, "lsmod")
+}
+func (modulesCollector) Collect(ctx context.Context, client *ssh.Client) (any, error) {
+	out, err := executeCommand(ctx, client, "lsmod")
+	if err != nil {
+		return nil, err
+	}
+	modules := parseLsmodOutput(out)
+	sort.Strings(modules)
+	return modules, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+func TestParseOSRelease(t *testing.T) {
+	out := parseOSRelease(`
+NAME="Debian GNU/Linux"
+ID=debian
+ID_LIKE=
+VERSION_ID="12"
+# a comment line
+PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+`)
+
+	if out["ID"] != "debian" {
+		t.Errorf(`ID = %q, want "debian"`, out["ID"])
+	}
+	if out["VERSION_ID"] != "12" {
+		t.Errorf(`VERSION_ID = %q, want "12" (quotes stripped)`, out["VERSION_ID"])
+	}
+	if out["PRETTY_NAME"] != "Debian GNU/Linux 12 (bookworm)" {
+		t.Errorf(`PRETTY_NAME = %q, want "Debian GNU/Linux 12 (bookworm)"`, out["PRETTY_NAME"])
+	}
+	if _, ok := out["#"]; ok {
+		t.Errorf("comment line was parsed as a field")
+	}
+}
+
+func TestParseApkOutput(t *testing.T) {
+	libs := parseApkOutput("musl-1.2.4-r2\nbusybox-1.36.1-r15\n\nopenssl-3.1.4-r5\n")
+
+	want := []InstalledLib{
+		{Name: "musl", Version: "1.2.4-r2"},
+		{Name: "busybox", Version: "1.36.1-r15"},
+		{Name: "openssl", Version: "3.1.4-r5"},
+	}
+	if len(libs) != len(want) {
+		t.Fatalf("got %d libs, want %d: %+v", len(libs), len(want), libs)
+	}
+	for i, lib := range libs {
+		if lib != want[i] {
+			t.Errorf("libs[%d] = %+v, want %+v", i, lib, want[i])
+		}
+	}
+}
+
+func TestParseOpenRCOutput(t *testing.T) {
+	units := parseOpenRCOutput(" Runlevel: default\n sshd                      [  started  ]\n cron                      [ stopped ]\n")
+
+	if len(units) != 2 {
+		t.Fatalf("got %d units, want 2: %+v", len(units), units)
+	}
+	if units[0].Name != "sshd" || units[0].ActiveState != "started" {
+		t.Errorf("units[0] = %+v, want Name=sshd ActiveState=started", units[0])
+	}
+	if units[1].Name != "cron" || units[1].ActiveState != "stopped" {
+		t.Errorf("units[1] = %+v, want Name=cron ActiveState=stopped", units[1])
+	}
+}
+
+func TestParseRcdOutput(t *testing.T) {
+	units := parseRcdOutput("/etc/rc.d/sshd\n/etc/rc.d/cron\n")
+
+	if len(units) != 2 {
+		t.Fatalf("got %d units, want 2: %+v", len(units), units)
+	}
+	if units[0].Name != "sshd" || units[0].ActiveState != "enabled" {
+		t.Errorf("units[0] = %+v, want Name=sshd ActiveState=enabled", units[0])
+	}
+	if units[1].Name != "cron" {
+		t.Errorf("units[1].Name = %q, want cron", units[1].Name)
+	}
+}
+
+func TestCollectorSelected(t *testing.T) {
+	if !collectorSelected("packages", nil) {
+		t.Error("collectorSelected(_, nil) = false, want true (empty selection means everything)")
+	}
+	if !collectorSelected("packages", []string{"packages", "network"}) {
+		t.Error("collectorSelected(packages, [packages, network]) = false, want true")
+	}
+	if collectorSelected("modules", []string{"packages", "network"}) {
+		t.Error("collectorSelected(modules, [packages, network]) = true, want false")
+	}
+}
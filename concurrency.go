@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GlobalConfig holds the flags that apply to the whole run rather than to
+// any one host.
+type GlobalConfig struct {
+	Concurrency    int           // --concurrency: max hosts collected at once
+	Timeout        time.Duration // --timeout: per-host overall deadline, 0 = none
+	ConnectTimeout time.Duration // --connect-timeout: dial deadline, 0 = none
+	Collectors     []string      // --collectors: restrict which collector categories run
+}
+
+// parseGlobalFlags pulls --concurrency, --timeout, and --connect-timeout out
+// of args and returns the remaining arguments for parseHostConfigs.
+func parseGlobalFlags(args []string) (GlobalConfig, []string, error) {
+	cfg := GlobalConfig{Concurrency: runtime.NumCPU()}
+	rest := make([]string, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--concurrency":
+			if i+1 >= len(args) {
+				return cfg, nil, fmt.Errorf("--concurrency flag without a value")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return cfg, nil, fmt.Errorf("--concurrency flag with invalid value %s", args[i+1])
+			}
+			cfg.Concurrency = n
+			i++
+		case "--timeout":
+			if i+1 >= len(args) {
+				return cfg, nil, fmt.Errorf("--timeout flag without a value")
+			}
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil {
+				return cfg, nil, fmt.Errorf("--timeout flag with invalid value %s: %w", args[i+1], err)
+			}
+			cfg.Timeout = d
+			i++
+		case "--connect-timeout":
+			if i+1 >= len(args) {
+				return cfg, nil, fmt.Errorf("--connect-timeout flag without a value")
+			}
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil {
+				return cfg, nil, fmt.Errorf("--connect-timeout flag with invalid value %s: %w", args[i+1], err)
+			}
+			cfg.ConnectTimeout = d
+			i++
+		case "--collectors":
+			if i+1 >= len(args) {
+				return cfg, nil, fmt.Errorf("--collectors flag without a value")
+			}
+			cfg.Collectors = strings.Split(args[i+1], ",")
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	return cfg, rest, nil
+}
+
+// logger is host-tagged via logger.With("host", ...) at each call site.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// hostResult records the outcome of collecting from a single host, for the
+// run summary printed at the end of main.
+type hostResult struct {
+	Host     string
+	User     string
+	Err      error
+	Duration time.Duration
+}
+
+// runHosts dispatches configs to a worker pool sized by gcfg.Concurrency and
+// collects one hostResult per host. Each host gets its own context bounded
+// by gcfg.Timeout.
+func runHosts(configs []HostConfig, gcfg GlobalConfig) []hostResult {
+	results := make([]hostResult, len(configs))
+	sem := make(chan struct{}, gcfg.Concurrency)
+	var wg sync.WaitGroup
+
+	for i, config := range configs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, config HostConfig) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ctx := context.Background()
+			if gcfg.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, gcfg.Timeout)
+				defer cancel()
+			}
+			results[i] = handleHost(ctx, config)
+		}(i, config)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// printSummary reports successes, failures, and durations for a completed
+// run to stdout.
+func printSummary(results []hostResult) {
+	var failed int
+	fmt.Println("\nSummary:")
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("  FAIL %s@%s (%s): %v\n", r.User, r.Host, r.Duration.Round(time.Millisecond), r.Err)
+		} else {
+			fmt.Printf("  OK   %s@%s (%s)\n", r.User, r.Host, r.Duration.Round(time.Millisecond))
+		}
+	}
+	fmt.Printf("%d succeeded, %d failed, %d total\n", len(results)-failed, failed, len(results))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseGlobalFlags(t *testing.T) {
+	t.Run("defaults to NumCPU concurrency and zero timeouts", func(t *testing.T) {
+		cfg, rest, err := parseGlobalFlags([]string{"user@host"})
+		if err != nil {
+			t.Fatalf("parseGlobalFlags returned error: %v", err)
+		}
+		if cfg.Concurrency != runtime.NumCPU() {
+			t.Errorf("Concurrency = %d, want %d", cfg.Concurrency, runtime.NumCPU())
+		}
+		if cfg.Timeout != 0 || cfg.ConnectTimeout != 0 {
+			t.Errorf("Timeout/ConnectTimeout = %v/%v, want 0/0", cfg.Timeout, cfg.ConnectTimeout)
+		}
+		if len(rest) != 1 || rest[0] != "user@host" {
+			t.Errorf("rest = %v, want [user@host] passed through untouched", rest)
+		}
+	})
+
+	t.Run("parses concurrency, timeout, connect-timeout, and collectors", func(t *testing.T) {
+		args := []string{
+			"--concurrency", "4",
+			"--timeout", "30s",
+			"--connect-timeout", "5s",
+			"--collectors", "packages,network",
+			"user@host",
+		}
+		cfg, rest, err := parseGlobalFlags(args)
+		if err != nil {
+			t.Fatalf("parseGlobalFlags returned error: %v", err)
+		}
+		if cfg.Concurrency != 4 {
+			t.Errorf("Concurrency = %d, want 4", cfg.Concurrency)
+		}
+		if cfg.Timeout != 30*time.Second {
+			t.Errorf("Timeout = %v, want 30s", cfg.Timeout)
+		}
+		if cfg.ConnectTimeout != 5*time.Second {
+			t.Errorf("ConnectTimeout = %v, want 5s", cfg.ConnectTimeout)
+		}
+		if len(cfg.Collectors) != 2 || cfg.Collectors[0] != "packages" || cfg.Collectors[1] != "network" {
+			t.Errorf("Collectors = %v, want [packages network]", cfg.Collectors)
+		}
+		if len(rest) != 1 || rest[0] != "user@host" {
+			t.Errorf("rest = %v, want [user@host]", rest)
+		}
+	})
+
+	t.Run("rejects a non-positive concurrency", func(t *testing.T) {
+		if _, _, err := parseGlobalFlags([]string{"--concurrency", "0"}); err == nil {
+			t.Error("expected an error for --concurrency 0, got nil")
+		}
+	})
+
+	t.Run("rejects an invalid timeout duration", func(t *testing.T) {
+		if _, _, err := parseGlobalFlags([]string{"--timeout", "not-a-duration"}); err == nil {
+			t.Error("expected an error for an invalid --timeout, got nil")
+		}
+	})
+
+	t.Run("rejects a flag missing its value", func(t *testing.T) {
+		if _, _, err := parseGlobalFlags([]string{"--concurrency"}); err == nil {
+			t.Error("expected an error for --concurrency without a value, got nil")
+		}
+	})
+}
+
+func TestCollectorSelectedEmptySelectionRunsEverything(t *testing.T) {
+	// collectorSelected itself is covered in collectors_test.go; this just
+	// checks parseGlobalFlags leaves Collectors nil (not an empty slice)
+	// when --collectors isn't given, since collectorSelected treats those
+	// the same but callers shouldn't rely on that by accident.
+	cfg, _, err := parseGlobalFlags(nil)
+	if err != nil {
+		t.Fatalf("parseGlobalFlags(nil) returned error: %v", err)
+	}
+	if cfg.Collectors != nil {
+		t.Errorf("Collectors = %v, want nil", cfg.Collectors)
+	}
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	debversion "github.com/knqyf263/go-deb-version"
+)
+
+// snapshotFile describes one json/<host>/<user>_<ts>.json file on disk.
+type snapshotFile struct {
+	Path      string
+	User      string
+	Timestamp string // the "2006_01_02_15_04_05" portion of the filename
+}
+
+var snapshotFilenameRE = regexp.MustCompile(`^(.+)_(\d{4}_\d{2}_\d{2}_\d{2}_\d{2}_\d{2})\.json$`)
+
+// listSnapshots returns every snapshot saveDetailsAsJSON wrote for host,
+// oldest first.
+func listSnapshots(host string) ([]snapshotFile, error) {
+	dir := filepath.Join("json", host)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory %s: %w", dir, err)
+	}
+
+	var snaps []snapshotFile
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := snapshotFilenameRE.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		snaps = append(snaps, snapshotFile{
+			Path:      filepath.Join(dir, e.Name()),
+			User:      m[1],
+			Timestamp: m[2],
+		})
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Timestamp < snaps[j].Timestamp })
+	return snaps, nil
+}
+
+// selectSnapshots picks the --from/--to snapshots for host, defaulting to
+// the two most recent when either is left empty.
+func selectSnapshots(host, from, to string) (snapshotFile, snapshotFile, error) {
+	snaps, err := listSnapshots(host)
+	if err != nil {
+		return snapshotFile{}, snapshotFile{}, err
+	}
+	if len(snaps) < 2 {
+		return snapshotFile{}, snapshotFile{}, fmt.Errorf("need at least 2 snapshots for host %s, found %d", host, len(snaps))
+	}
+
+	fromSnap, toSnap := snaps[len(snaps)-2], snaps[len(snaps)-1]
+	if from != "" {
+		if fromSnap, err = findSnapshot(snaps, from); err != nil {
+			return snapshotFile{}, snapshotFile{}, err
+		}
+	}
+	if to != "" {
+		if toSnap, err = findSnapshot(snaps, to); err != nil {
+			return snapshotFile{}, snapshotFile{}, err
+		}
+	}
+	return fromSnap, toSnap, nil
+}
+
+func findSnapshot(snaps []snapshotFile, ts string) (snapshotFile, error) {
+	for _, s := range snaps {
+		if s.Timestamp == ts {
+			return s, nil
+		}
+	}
+	return snapshotFile{}, fmt.Errorf("no snapshot with timestamp %s", ts)
+}
+
+// rawSystemDetails mirrors SystemDetails but keeps each collector's payload
+// as raw JSON, so diffSnapshots only decodes the collectors it needs.
+type rawSystemDetails struct {
+	Timestamp     time.Time                  `json:"timestamp"`
+	OSFamily      string                     `json:"os_family"`
+	DistroID      string                     `json:"distro_id"`
+	Architecture  string                     `json:"architecture"`
+	KernelVersion string                     `json:"kernel_version"`
+	Collectors    map[string]json.RawMessage `json:"collectors"`
+}
+
+func loadSnapshot(path string) (*rawSystemDetails, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", path, err)
+	}
+	var details rawSystemDetails
+	if err := json.Unmarshal(data, &details); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	return &details, nil
+}
+
+func decodeCollector[T any](r *rawSystemDetails, key string) (T, error) {
+	var v T
+	raw, ok := r.Collectors[key]
+	if !ok {
+		return v, nil
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return v, fmt.Errorf("failed to decode %s collector: %w", key, err)
+	}
+	return v, nil
+}
+
+// SnapshotDiff is the structured report produced by diffSnapshots.
+type SnapshotDiff struct {
+	Host          string       `json:"host"`
+	FromTimestamp string       `json:"from_timestamp"`
+	ToTimestamp   string       `json:"to_timestamp"`
+	DistroChange  *ValueChange `json:"distro_id_change,omitempty"`
+	KernelChange  *ValueChange `json:"kernel_version_change,omitempty"`
+
+	PackagesAdded      []InstalledLib   `json:"packages_added,omitempty"`
+	PackagesRemoved    []InstalledLib   `json:"packages_removed,omitempty"`
+	PackagesUpgraded   []PackageUpgrade `json:"packages_upgraded,omitempty"`
+	PackagesDowngraded []PackageUpgrade `json:"packages_downgraded,omitempty"`
+
+	ModulesAdded   []string `json:"modules_added,omitempty"`
+	ModulesRemoved []string `json:"modules_removed,omitempty"`
+
+	UnitsChanged []UnitTransition `json:"units_changed,omitempty"`
+
+	NetworkChange *NetworkDiff `json:"network_change,omitempty"`
+}
+
+// ValueChange is a before/after pair for a single scalar field.
+type ValueChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// PackageUpgrade records a package whose version changed between snapshots.
+type PackageUpgrade struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// UnitTransition records a service's load/active state across snapshots. A
+// zero FromLoadState/FromActiveState means the unit is new; a zero
+// ToLoadState/ToActiveState means it disappeared.
+type UnitTransition struct {
+	Name            string `json:"name"`
+	FromLoadState   string `json:"from_load_state,omitempty"`
+	ToLoadState     string `json:"to_load_state,omitempty"`
+	FromActiveState string `json:"from_active_state,omitempty"`
+	ToActiveState   string `json:"to_active_state,omitempty"`
+}
+
+// NetworkDiff is nil when nothing about the network changed.
+type NetworkDiff struct {
+	AddressesAdded    []string     `json:"addresses_added,omitempty"`
+	AddressesRemoved  []string     `json:"addresses_removed,omitempty"`
+	InterfacesAdded   []string     `json:"interfaces_added,omitempty"`
+	InterfacesRemoved []string     `json:"interfaces_removed,omitempty"`
+	RoutingInfoChange *ValueChange `json:"routing_info_change,omitempty"`
+}
+
+// diffSnapshots compares from against to and produces a SnapshotDiff; Host,
+// FromTimestamp, and ToTimestamp are left for the caller to fill in.
+func diffSnapshots(from, to *rawSystemDetails) (*SnapshotDiff, error) {
+	diff := &SnapshotDiff{}
+
+	if from.DistroID != to.DistroID {
+		diff.DistroChange = &ValueChange{From: from.DistroID, To: to.DistroID}
+	}
+	if from.KernelVersion != to.KernelVersion {
+		diff.KernelChange = &ValueChange{From: from.KernelVersion, To: to.KernelVersion}
+	}
+
+	fromPkgs, err := decodeCollector[[]InstalledLib](from, "packages")
+	if err != nil {
+		return nil, err
+	}
+	toPkgs, err := decodeCollector[[]InstalledLib](to, "packages")
+	if err != nil {
+		return nil, err
+	}
+	diff.PackagesAdded, diff.PackagesRemoved, diff.PackagesUpgraded, diff.PackagesDowngraded = diffPackages(fromPkgs, toPkgs)
+
+	fromModules, err := decodeCollector[[]string](from, "modules")
+	if err != nil {
+		return nil, err
+	}
+	toModules, err := decodeCollector[[]string](to, "modules")
+	if err != nil {
+		return nil, err
+	}
+	diff.ModulesAdded, diff.ModulesRemoved = diffStringSlices(fromModules, toModules)
+
+	fromUnits, err := decodeCollector[[]SystemdUnit](from, "services")
+	if err != nil {
+		return nil, err
+	}
+	toUnits, err := decodeCollector[[]SystemdUnit](to, "services")
+	if err != nil {
+		return nil, err
+	}
+	diff.UnitsChanged = diffUnits(fromUnits, toUnits)
+
+	fromNet, err := decodeCollector[NetworkConfig](from, "network")
+	if err != nil {
+		return nil, err
+	}
+	toNet, err := decodeCollector[NetworkConfig](to, "network")
+	if err != nil {
+		return nil, err
+	}
+	diff.NetworkChange = diffNetwork(fromNet, toNet)
+
+	return diff, nil
+}
+
+// diffPackages compares two package lists by name, using Debian version
+// ordering (via compareVersions) to sort each changed package into upgraded
+// or downgraded.
+func diffPackages(from, to []InstalledLib) (added, removed []InstalledLib, upgraded, downgraded []PackageUpgrade) {
+	fromVersion := make(map[string]string, len(from))
+	for _, p := range from {
+		fromVersion[p.Name] = p.Version
+	}
+	toVersion := make(map[string]string, len(to))
+	for _, p := range to {
+		toVersion[p.Name] = p.Version
+	}
+
+	for _, p := range to {
+		oldVersion, existed := fromVersion[p.Name]
+		if !existed {
+			added = append(added, p)
+			continue
+		}
+		if oldVersion == p.Version {
+			continue
+		}
+		change := PackageUpgrade{Name: p.Name, From: oldVersion, To: p.Version}
+		if compareVersions(oldVersion, p.Version) > 0 {
+			downgraded = append(downgraded, change)
+		} else {
+			upgraded = append(upgraded, change)
+		}
+	}
+	for _, p := range from {
+		if _, stillPresent := toVersion[p.Name]; !stillPresent {
+			removed = append(removed, p)
+		}
+	}
+
+	sort.Slice(added, func(i, j int) bool { return added[i].Name < added[j].Name })
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Name < removed[j].Name })
+	sort.Slice(upgraded, func(i, j int) bool { return upgraded[i].Name < upgraded[j].Name })
+	sort.Slice(downgraded, func(i, j int) bool { return downgraded[i].Name < downgraded[j].Name })
+	return added, removed, upgraded, downgraded
+}
+
+// compareVersions reports whether a is older than, equal to, or newer than
+// b, using dpkg --compare-versions semantics. If either string fails to
+// parse, it falls back to a plain string comparison.
+func compareVersions(a, b string) int {
+	va, errA := debversion.NewVersion(a)
+	vb, errB := debversion.NewVersion(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	return va.Compare(vb)
+}
+
+// diffStringSlices reports which entries are only in to (added) and which
+// are only in from (removed).
+func diffStringSlices(from, to []string) (added, removed []string) {
+	fromSet := make(map[string]bool, len(from))
+	for _, s := range from {
+		fromSet[s] = true
+	}
+	toSet := make(map[string]bool, len(to))
+	for _, s := range to {
+		toSet[s] = true
+	}
+	for _, s := range to {
+		if !fromSet[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range from {
+		if !toSet[s] {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// diffUnits reports every unit whose LoadState/ActiveState changed, along
+// with units that appeared or disappeared entirely.
+func diffUnits(from, to []SystemdUnit) []UnitTransition {
+	fromByName := make(map[string]SystemdUnit, len(from))
+	for _, u := range from {
+		fromByName[u.Name] = u
+	}
+	toByName := make(map[string]SystemdUnit, len(to))
+	for _, u := range to {
+		toByName[u.Name] = u
+	}
+
+	var transitions []UnitTransition
+	for _, u := range to {
+		old, existed := fromByName[u.Name]
+		if !existed {
+			transitions = append(transitions, UnitTransition{Name: u.Name, ToLoadState: u.LoadState, ToActiveState: u.ActiveState})
+			continue
+		}
+		if old.LoadState != u.LoadState || old.ActiveState != u.ActiveState {
+			transitions = append(transitions, UnitTransition{
+				Name:            u.Name,
+				FromLoadState:   old.LoadState,
+				ToLoadState:     u.LoadState,
+				FromActiveState: old.ActiveState,
+				ToActiveState:   u.ActiveState,
+			})
+		}
+	}
+	for _, u := range from {
+		if _, stillPresent := toByName[u.Name]; !stillPresent {
+			transitions = append(transitions, UnitTransition{Name: u.Name, FromLoadState: u.LoadState, FromActiveState: u.ActiveState})
+		}
+	}
+
+	sort.Slice(transitions, func(i, j int) bool { return transitions[i].Name < transitions[j].Name })
+	return transitions
+}
+
+// diffNetwork returns nil when addresses, interfaces, and routing info are
+// all unchanged.
+func diffNetwork(from, to NetworkConfig) *NetworkDiff {
+	addrAdded, addrRemoved := diffStringSlices(from.IPAddresses, to.IPAddresses)
+	ifAdded, ifRemoved := diffStringSlices(from.Interfaces, to.Interfaces)
+
+	var routeChange *ValueChange
+	if from.RoutingInfo != to.RoutingInfo {
+		routeChange = &ValueChange{From: from.RoutingInfo, To: to.RoutingInfo}
+	}
+
+	if len(addrAdded) == 0 && len(addrRemoved) == 0 && len(ifAdded) == 0 && len(ifRemoved) == 0 && routeChange == nil {
+		return nil
+	}
+	return &NetworkDiff{
+		AddressesAdded:    addrAdded,
+		AddressesRemoved:  addrRemoved,
+		InterfacesAdded:   ifAdded,
+		InterfacesRemoved: ifRemoved,
+		RoutingInfoChange: routeChange,
+	}
+}
+
+// validFailOnCriteria are the recognized --fail-on values.
+var validFailOnCriteria = map[string]bool{
+	"pkg-added":      true,
+	"pkg-removed":    true,
+	"pkg-upgraded":   true,
+	"pkg-downgraded": true,
+	"module-removed": true,
+	"unit-failed":    true,
+}
+
+// checkFailOnCriteria rejects any --fail-on value not in validFailOnCriteria,
+// so a typo fails loudly instead of silently never tripping.
+func checkFailOnCriteria(criteria []string) error {
+	for _, c := range criteria {
+		if !validFailOnCriteria[c] {
+			return fmt.Errorf("unknown --fail-on criterion %q", c)
+		}
+	}
+	return nil
+}
+
+// evalFailOn reports whether diff trips any of criteria; criteria must
+// already be validated by checkFailOnCriteria.
+func evalFailOn(diff *SnapshotDiff, criteria []string) bool {
+	for _, c := range criteria {
+		switch c {
+		case "pkg-added":
+			if len(diff.PackagesAdded) > 0 {
+				return true
+			}
+		case "pkg-removed":
+			if len(diff.PackagesRemoved) > 0 {
+				return true
+			}
+		case "pkg-upgraded":
+			if len(diff.PackagesUpgraded) > 0 {
+				return true
+			}
+		case "pkg-downgraded":
+			if len(diff.PackagesDowngraded) > 0 {
+				return true
+			}
+		case "module-removed":
+			if len(diff.ModulesRemoved) > 0 {
+				return true
+			}
+		case "unit-failed":
+			for _, t := range diff.UnitsChanged {
+				if t.ToActiveState == "failed" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// printDiff renders diff to stdout in the given --format (text, json, or
+// markdown).
+func printDiff(diff *SnapshotDiff, format string) error {
+	switch format {
+	case "", "text":
+		printDiffText(diff)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(diff)
+	case "markdown":
+		printDiffMarkdown(diff)
+	default:
+		return fmt.Errorf("unknown --format value %q (want text, json, or markdown)", format)
+	}
+	return nil
+}
+
+func printDiffText(d *SnapshotDiff) {
+	fmt.Printf("Diff for %s: %s -> %s\n", d.Host, d.FromTimestamp, d.ToTimestamp)
+	if d.DistroChange != nil {
+		fmt.Printf("  distro:  %s -> %s\n", d.DistroChange.From, d.DistroChange.To)
+	}
+	if d.KernelChange != nil {
+		fmt.Printf("  kernel:  %s -> %s\n", d.KernelChange.From, d.KernelChange.To)
+	}
+	for _, p := range d.PackagesAdded {
+		fmt.Printf("  + pkg %s %s\n", p.Name, p.Version)
+	}
+	for _, p := range d.PackagesRemoved {
+		fmt.Printf("  - pkg %s %s\n", p.Name, p.Version)
+	}
+	for _, p := range d.PackagesUpgraded {
+		fmt.Printf("  ~ pkg %s %s -> %s\n", p.Name, p.From, p.To)
+	}
+	for _, p := range d.PackagesDowngraded {
+		fmt.Printf("  v pkg %s %s -> %s\n", p.Name, p.From, p.To)
+	}
+	for _, m := range d.ModulesAdded {
+		fmt.Printf("  + module %s\n", m)
+	}
+	for _, m := range d.ModulesRemoved {
+		fmt.Printf("  - module %s\n", m)
+	}
+	for _, t := range d.UnitsChanged {
+		fmt.Printf("  ~ unit %s: %s/%s -> %s/%s\n", t.Name, t.FromLoadState, t.FromActiveState, t.ToLoadState, t.ToActiveState)
+	}
+	if nc := d.NetworkChange; nc != nil {
+		for _, a := range nc.AddressesAdded {
+			fmt.Printf("  + ip %s\n", a)
+		}
+		for _, a := range nc.AddressesRemoved {
+			fmt.Printf("  - ip %s\n", a)
+		}
+		for _, i := range nc.InterfacesAdded {
+			fmt.Printf("  + iface %s\n", i)
+		}
+		for _, i := range nc.InterfacesRemoved {
+			fmt.Printf("  - iface %s\n", i)
+		}
+		if nc.RoutingInfoChange != nil {
+			fmt.Println("  routes changed")
+		}
+	}
+}
+
+func printDiffMarkdown(d *SnapshotDiff) {
+	fmt.Printf("## Diff for `%s`: %s -> %s\n", d.Host, d.FromTimestamp, d.ToTimestamp)
+	if d.DistroChange != nil {
+		fmt.Printf("- **distro**: `%s` -> `%s`\n", d.DistroChange.From, d.DistroChange.To)
+	}
+	if d.KernelChange != nil {
+		fmt.Printf("- **kernel**: `%s` -> `%s`\n", d.KernelChange.From, d.KernelChange.To)
+	}
+	if len(d.PackagesAdded) > 0 {
+		fmt.Println("\n### Packages added")
+		for _, p := range d.PackagesAdded {
+			fmt.Printf("- `%s` %s\n", p.Name, p.Version)
+		}
+	}
+	if len(d.PackagesRemoved) > 0 {
+		fmt.Println("\n### Packages removed")
+		for _, p := range d.PackagesRemoved {
+			fmt.Printf("- `%s` %s\n", p.Name, p.Version)
+		}
+	}
+	if len(d.PackagesUpgraded) > 0 {
+		fmt.Println("\n### Packages upgraded")
+		for _, p := range d.PackagesUpgraded {
+			fmt.Printf("- `%s` %s -> %s\n", p.Name, p.From, p.To)
+		}
+	}
+	if len(d.PackagesDowngraded) > 0 {
+		fmt.Println("\n### Packages downgraded")
+		for _, p := range d.PackagesDowngraded {
+			fmt.Printf("- `%s` %s -> %s\n", p.Name, p.From, p.To)
+		}
+	}
+	if len(d.ModulesAdded) > 0 {
+		fmt.Println("\n### Modules added")
+		for _, m := range d.ModulesAdded {
+			fmt.Printf("- `%s`\n", m)
+		}
+	}
+	if len(d.ModulesRemoved) > 0 {
+		fmt.Println("\n### Modules removed")
+		for _, m := range d.ModulesRemoved {
+			fmt.Printf("- `%s`\n", m)
+		}
+	}
+	if len(d.UnitsChanged) > 0 {
+		fmt.Println("\n### Unit state changes")
+		for _, t := range d.UnitsChanged {
+			fmt.Printf("- `%s`: %s/%s -> %s/%s\n", t.Name, t.FromLoadState, t.FromActiveState, t.ToLoadState, t.ToActiveState)
+		}
+	}
+	if nc := d.NetworkChange; nc != nil {
+		fmt.Println("\n### Network changes")
+		for _, a := range nc.AddressesAdded {
+			fmt.Printf("- + ip `%s`\n", a)
+		}
+		for _, a := range nc.AddressesRemoved {
+			fmt.Printf("- - ip `%s`\n", a)
+		}
+		for _, i := range nc.InterfacesAdded {
+			fmt.Printf("- + iface `%s`\n", i)
+		}
+		for _, i := range nc.InterfacesRemoved {
+			fmt.Printf("- - iface `%s`\n", i)
+		}
+		if nc.RoutingInfoChange != nil {
+			fmt.Println("- routes changed")
+		}
+	}
+}
+
+// runDiffCommand implements "meikkalainen diff <host> [--from ts] [--to ts]
+// [--format text|json|markdown] [--fail-on pkg-removed,unit-failed]".
+func runDiffCommand(args []string) {
+	if len(args) < 1 {
+		log.Fatalf("Usage: meikkalainen diff <host> [--from ts] [--to ts] [--format text|json|markdown] [--fail-on pkg-removed,unit-failed]")
+	}
+	host := args[0]
+
+	format := "text"
+	var from, to string
+	var failOn []string
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--from":
+			if i+1 >= len(args) {
+				log.Fatalf("--from flag without a value")
+			}
+			from = args[i+1]
+			i++
+		case "--to":
+			if i+1 >= len(args) {
+				log.Fatalf("--to flag without a value")
+			}
+			to = args[i+1]
+			i++
+		case "--format":
+			if i+1 >= len(args) {
+				log.Fatalf("--format flag without a value")
+			}
+			format = args[i+1]
+			i++
+		case "--fail-on":
+			if i+1 >= len(args) {
+				log.Fatalf("--fail-on flag without a value")
+			}
+			for _, c := range strings.Split(args[i+1], ",") {
+				failOn = append(failOn, strings.TrimSpace(c))
+			}
+			i++
+		default:
+			log.Fatalf("unknown diff flag %s", args[i])
+		}
+	}
+
+	if err := checkFailOnCriteria(failOn); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	fromSnap, toSnap, err := selectSnapshots(host, from, to)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	fromDetails, err := loadSnapshot(fromSnap.Path)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	toDetails, err := loadSnapshot(toSnap.Path)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	diff, err := diffSnapshots(fromDetails, toDetails)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	diff.Host = host
+	diff.FromTimestamp = fromSnap.Timestamp
+	diff.ToTimestamp = toSnap.Timestamp
+
+	if err := printDiff(diff, format); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if len(failOn) > 0 && evalFailOn(diff, failOn) {
+		os.Exit(1)
+	}
+}
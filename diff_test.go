@@ -0,0 +1,152 @@
+package main
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int // -1, 0, or 1, compared via sign
+	}{
+		{"1.0-1", "1.0-2", -1},
+		{"2.0-1", "1.0-1", 1},
+		{"1.0-1", "1.0-1", 0},
+		{"1:1.0-1", "2.0-1", 1}, // epoch beats a higher upstream version
+	}
+
+	for _, c := range cases {
+		got := compareVersions(c.a, c.b)
+		if sign(got) != c.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want sign %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func TestDiffPackages(t *testing.T) {
+	from := []InstalledLib{
+		{Name: "bash", Version: "5.1-2"},
+		{Name: "curl", Version: "7.88.1-10"},
+		{Name: "vim", Version: "9.0-2"},
+	}
+	to := []InstalledLib{
+		{Name: "bash", Version: "5.1-2"},
+		{Name: "curl", Version: "7.88.1-11"}, // upgraded
+		{Name: "vim", Version: "9.0-1"},      // downgraded
+		{Name: "htop", Version: "3.2.2-1"},   // added
+	}
+
+	added, removed, upgraded, downgraded := diffPackages(from, to)
+
+	if len(added) != 1 || added[0].Name != "htop" {
+		t.Errorf("added = %+v, want [htop]", added)
+	}
+	if len(removed) != 0 {
+		t.Errorf("removed = %+v, want none", removed)
+	}
+	if len(upgraded) != 1 || upgraded[0].Name != "curl" {
+		t.Errorf("upgraded = %+v, want [curl]", upgraded)
+	}
+	if len(downgraded) != 1 || downgraded[0].Name != "vim" {
+		t.Errorf("downgraded = %+v, want [vim]", downgraded)
+	}
+}
+
+func TestDiffStringSlices(t *testing.T) {
+	added, removed := diffStringSlices([]string{"a", "b"}, []string{"b", "c"})
+	if len(added) != 1 || added[0] != "c" {
+		t.Errorf("added = %v, want [c]", added)
+	}
+	if len(removed) != 1 || removed[0] != "a" {
+		t.Errorf("removed = %v, want [a]", removed)
+	}
+}
+
+func TestDiffUnits(t *testing.T) {
+	from := []SystemdUnit{
+		{Name: "nginx.service", LoadState: "loaded", ActiveState: "active"},
+		{Name: "old.service", LoadState: "loaded", ActiveState: "active"},
+	}
+	to := []SystemdUnit{
+		{Name: "nginx.service", LoadState: "loaded", ActiveState: "failed"},
+		{Name: "new.service", LoadState: "loaded", ActiveState: "active"},
+	}
+
+	transitions := diffUnits(from, to)
+	if len(transitions) != 3 {
+		t.Fatalf("got %d transitions, want 3: %+v", len(transitions), transitions)
+	}
+
+	byName := make(map[string]UnitTransition, len(transitions))
+	for _, tr := range transitions {
+		byName[tr.Name] = tr
+	}
+
+	if tr := byName["nginx.service"]; tr.FromActiveState != "active" || tr.ToActiveState != "failed" {
+		t.Errorf("nginx.service transition = %+v, want active -> failed", tr)
+	}
+	if tr := byName["new.service"]; tr.FromActiveState != "" || tr.ToActiveState != "active" {
+		t.Errorf("new.service transition = %+v, want a fresh unit", tr)
+	}
+	if tr := byName["old.service"]; tr.ToActiveState != "" || tr.FromActiveState != "active" {
+		t.Errorf("old.service transition = %+v, want a vanished unit", tr)
+	}
+}
+
+func TestDiffNetwork(t *testing.T) {
+	same := NetworkConfig{IPAddresses: []string{"10.0.0.1"}, Interfaces: []string{"eth0"}, RoutingInfo: "default via 10.0.0.254"}
+	if got := diffNetwork(same, same); got != nil {
+		t.Errorf("diffNetwork(same, same) = %+v, want nil", got)
+	}
+
+	from := NetworkConfig{IPAddresses: []string{"10.0.0.1"}, Interfaces: []string{"eth0"}, RoutingInfo: "default via 10.0.0.254"}
+	to := NetworkConfig{IPAddresses: []string{"10.0.0.2"}, Interfaces: []string{"eth0"}, RoutingInfo: "default via 10.0.0.1"}
+	got := diffNetwork(from, to)
+	if got == nil {
+		t.Fatal("diffNetwork(from, to) = nil, want a diff")
+	}
+	if len(got.AddressesAdded) != 1 || got.AddressesAdded[0] != "10.0.0.2" {
+		t.Errorf("AddressesAdded = %v, want [10.0.0.2]", got.AddressesAdded)
+	}
+	if len(got.AddressesRemoved) != 1 || got.AddressesRemoved[0] != "10.0.0.1" {
+		t.Errorf("AddressesRemoved = %v, want [10.0.0.1]", got.AddressesRemoved)
+	}
+	if got.RoutingInfoChange == nil {
+		t.Error("RoutingInfoChange = nil, want a change")
+	}
+}
+
+func TestCheckFailOnCriteria(t *testing.T) {
+	if err := checkFailOnCriteria([]string{"pkg-removed", "unit-failed"}); err != nil {
+		t.Errorf("checkFailOnCriteria(valid) returned error: %v", err)
+	}
+	if err := checkFailOnCriteria([]string{"pkg-sideways"}); err == nil {
+		t.Error("checkFailOnCriteria(unknown) = nil error, want an error")
+	}
+}
+
+func TestEvalFailOn(t *testing.T) {
+	diff := &SnapshotDiff{
+		PackagesRemoved: []InstalledLib{{Name: "vim", Version: "9.0-2"}},
+		UnitsChanged:    []UnitTransition{{Name: "nginx.service", ToActiveState: "failed"}},
+	}
+
+	if !evalFailOn(diff, []string{"pkg-removed"}) {
+		t.Error("evalFailOn with pkg-removed criterion = false, want true")
+	}
+	if !evalFailOn(diff, []string{"unit-failed"}) {
+		t.Error("evalFailOn with unit-failed criterion = false, want true")
+	}
+	if evalFailOn(diff, []string{"pkg-added"}) {
+		t.Error("evalFailOn with pkg-added criterion = true, want false")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/mdns"
+)
+
+// defaultDiscoverServiceType is used by the "discover" subcommand when no
+// --discover service type is given.
+const defaultDiscoverServiceType = "_ssh._tcp"
+
+// DiscoverConfig holds the flags controlling mDNS/Zeroconf host discovery.
+type DiscoverConfig struct {
+	ServiceType string         // --discover, e.g. "_ssh._tcp"; empty means discovery is off
+	Filter      *regexp.Regexp // --discover-filter, matched against the instance name
+	Timeout     time.Duration  // --discover-timeout
+	TXTFilters  map[string]string
+	User        string // --discover-user, the user to connect as on discovered hosts
+}
+
+// parseDiscoverFlags extracts --discover, --discover-filter,
+// --discover-timeout, --discover-txt, and --discover-user from args,
+// returning the remaining arguments alongside the parsed config.
+func parseDiscoverFlags(args []string) (DiscoverConfig, []string, error) {
+	cfg := DiscoverConfig{Timeout: 5 * time.Second, User: "root"}
+	rest := make([]string, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--discover":
+			if i+1 >= len(args) {
+				return cfg, nil, fmt.Errorf("--discover flag without a value")
+			}
+			cfg.ServiceType = args[i+1]
+			i++
+		case "--discover-filter":
+			if i+1 >= len(args) {
+				return cfg, nil, fmt.Errorf("--discover-filter flag without a value")
+			}
+			re, err := regexp.Compile(args[i+1])
+			if err != nil {
+				return cfg, nil, fmt.Errorf("--discover-filter flag with invalid regex %s: %w", args[i+1], err)
+			}
+			cfg.Filter = re
+			i++
+		case "--discover-timeout":
+			if i+1 >= len(args) {
+				return cfg, nil, fmt.Errorf("--discover-timeout flag without a value")
+			}
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil {
+				return cfg, nil, fmt.Errorf("--discover-timeout flag with invalid value %s: %w", args[i+1], err)
+			}
+			cfg.Timeout = d
+			i++
+		case "--discover-txt":
+			if i+1 >= len(args) {
+				return cfg, nil, fmt.Errorf("--discover-txt flag without a value")
+			}
+			kv := strings.SplitN(args[i+1], "=", 2)
+			if len(kv) != 2 {
+				return cfg, nil, fmt.Errorf("--discover-txt flag expects key=value, got %s", args[i+1])
+			}
+			if cfg.TXTFilters == nil {
+				cfg.TXTFilters = make(map[string]string)
+			}
+			cfg.TXTFilters[kv[0]] = kv[1]
+			i++
+		case "--discover-user":
+			if i+1 >= len(args) {
+				return cfg, nil, fmt.Errorf("--discover-user flag without a value")
+			}
+			cfg.User = args[i+1]
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	return cfg, rest, nil
+}
+
+// discoverHosts browses cfg.ServiceType on the LAN and returns a HostConfig
+// for every responder that passes cfg.Filter and cfg.TXTFilters. Each
+// HostConfig goes through the same ~/.ssh/config resolution and auth
+// defaulting as a CLI-specified host (see applySSHConfig/applyAuthDefaults
+// in main.go), so discovered hosts end up with a usable auth method instead
+// of the zero-valued IdentityPaths/AuthOrder authMethodsFor would reject.
+func discoverHosts(cfg DiscoverConfig) ([]HostConfig, error) {
+	sshCfg, err := loadSSHConfig(defaultSSHConfigPath())
+	if err != nil {
+		return nil, err
+	}
+
+	entriesCh := make(chan *mdns.ServiceEntry, 16)
+	var found []HostConfig
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for entry := range entriesCh {
+			if cfg.Filter != nil && !cfg.Filter.MatchString(entry.Name) {
+				continue
+			}
+			if !matchesTXTFilters(entry.InfoFields, cfg.TXTFilters) {
+				continue
+			}
+
+			host := entry.AddrV4.String()
+			if host == "" || host == "<nil>" {
+				host = entry.Host
+			}
+			hc := HostConfig{
+				User:                  cfg.User,
+				Hostname:              host,
+				Port:                  entry.Port,
+				StrictHostKeyChecking: defaultStrictHostKeyChecking,
+			}
+			applySSHConfig(&hc, host, sshCfg, defaultPrivateKeyPath, defaultPort)
+			applyAuthDefaults(&hc)
+			fmt.Printf("Discovered host %s (%s@%s:%d)\n", entry.Name, hc.User, hc.Hostname, hc.Port)
+			found = append(found, hc)
+		}
+	}()
+
+	params := mdns.DefaultParams(cfg.ServiceType)
+	params.Entries = entriesCh
+	params.Timeout = cfg.Timeout
+	if err := mdns.Query(params); err != nil {
+		close(entriesCh)
+		return nil, fmt.Errorf("mDNS query for %s failed: %w", cfg.ServiceType, err)
+	}
+	close(entriesCh)
+	<-done
+
+	return found, nil
+}
+
+// matchesTXTFilters reports whether every key=value pair in want is present
+// among fields (each a "key=value" TXT record, as in
+// mdns.ServiceEntry.InfoFields).
+func matchesTXTFilters(fields []string, want map[string]string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	got := make(map[string]string, len(fields))
+	for _, f := range fields {
+		if kv := strings.SplitN(f, "=", 2); len(kv) == 2 {
+			got[kv[0]] = kv[1]
+		}
+	}
+	for k, v := range want {
+		if got[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// dedupeDiscovered drops any entry in discovered whose user@host:port
+// already appears among explicit.
+func dedupeDiscovered(explicit, discovered []HostConfig) []HostConfig {
+	seen := make(map[string]bool, len(explicit))
+	for _, hc := range explicit {
+		seen[hostKey(hc)] = true
+	}
+
+	var out []HostConfig
+	for _, hc := range discovered {
+		k := hostKey(hc)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, hc)
+	}
+	return out
+}
+
+func hostKey(hc HostConfig) string {
+	return fmt.Sprintf("%s@%s:%d", hc.User, hc.Hostname, hc.Port)
+}
+
+// runDiscoverCommand implements the "meikkalainen discover" subcommand: it
+// only browses and prints, it doesn't connect to anything.
+func runDiscoverCommand(args []string) {
+	cfg, _, err := parseDiscoverFlags(args)
+	if err != nil {
+		log.Fatalf("Error parsing discover flags: %v", err)
+	}
+	if cfg.ServiceType == "" {
+		cfg.ServiceType = defaultDiscoverServiceType
+	}
+
+	hosts, err := discoverHosts(cfg)
+	if err != nil {
+		log.Fatalf("Discovery failed: %v", err)
+	}
+
+	fmt.Printf("Found %d host(s) advertising %s\n", len(hosts), cfg.ServiceType)
+	for _, hc := range hosts {
+		fmt.Printf("  %s@%s:%d\n", hc.User, hc.Hostname, hc.Port)
+	}
+}
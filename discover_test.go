@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDiscoverFlags(t *testing.T) {
+	t.Run("defaults to a 5s timeout and root user, discovery off", func(t *testing.T) {
+		cfg, rest, err := parseDiscoverFlags([]string{"user@host"})
+		if err != nil {
+			t.Fatalf("parseDiscoverFlags returned error: %v", err)
+		}
+		if cfg.ServiceType != "" {
+			t.Errorf("ServiceType = %q, want empty (discovery off)", cfg.ServiceType)
+		}
+		if cfg.Timeout != 5*time.Second {
+			t.Errorf("Timeout = %v, want 5s", cfg.Timeout)
+		}
+		if cfg.User != "root" {
+			t.Errorf("User = %q, want root", cfg.User)
+		}
+		if len(rest) != 1 || rest[0] != "user@host" {
+			t.Errorf("rest = %v, want [user@host] passed through untouched", rest)
+		}
+	})
+
+	t.Run("parses discover, filter, timeout, txt, and user flags", func(t *testing.T) {
+		args := []string{
+			"--discover", "_ssh._tcp",
+			"--discover-filter", "^web-",
+			"--discover-timeout", "2s",
+			"--discover-txt", "env=prod",
+			"--discover-user", "ops",
+		}
+		cfg, rest, err := parseDiscoverFlags(args)
+		if err != nil {
+			t.Fatalf("parseDiscoverFlags returned error: %v", err)
+		}
+		if cfg.ServiceType != "_ssh._tcp" {
+			t.Errorf("ServiceType = %q, want _ssh._tcp", cfg.ServiceType)
+		}
+		if cfg.Filter == nil || !cfg.Filter.MatchString("web-1") {
+			t.Errorf("Filter = %v, want one matching \"web-1\"", cfg.Filter)
+		}
+		if cfg.Timeout != 2*time.Second {
+			t.Errorf("Timeout = %v, want 2s", cfg.Timeout)
+		}
+		if cfg.TXTFilters["env"] != "prod" {
+			t.Errorf("TXTFilters[env] = %q, want prod", cfg.TXTFilters["env"])
+		}
+		if cfg.User != "ops" {
+			t.Errorf("User = %q, want ops", cfg.User)
+		}
+		if len(rest) != 0 {
+			t.Errorf("rest = %v, want empty", rest)
+		}
+	})
+
+	t.Run("rejects an invalid filter regex", func(t *testing.T) {
+		if _, _, err := parseDiscoverFlags([]string{"--discover-filter", "(unclosed"}); err == nil {
+			t.Error("expected an error for an invalid --discover-filter regex, got nil")
+		}
+	})
+
+	t.Run("rejects a --discover-txt value without =", func(t *testing.T) {
+		if _, _, err := parseDiscoverFlags([]string{"--discover-txt", "envprod"}); err == nil {
+			t.Error("expected an error for a --discover-txt value missing '=', got nil")
+		}
+	})
+
+	t.Run("rejects a flag missing its value", func(t *testing.T) {
+		if _, _, err := parseDiscoverFlags([]string{"--discover"}); err == nil {
+			t.Error("expected an error for --discover without a value, got nil")
+		}
+	})
+}
+
+func TestMatchesTXTFilters(t *testing.T) {
+	fields := []string{"env=prod", "region=us-east"}
+
+	if !matchesTXTFilters(fields, nil) {
+		t.Error("matchesTXTFilters(_, nil) = false, want true (no filters means match everything)")
+	}
+	if !matchesTXTFilters(fields, map[string]string{"env": "prod"}) {
+		t.Error("matchesTXTFilters with a satisfied filter = false, want true")
+	}
+	if matchesTXTFilters(fields, map[string]string{"env": "staging"}) {
+		t.Error("matchesTXTFilters with a mismatched value = true, want false")
+	}
+	if matchesTXTFilters(fields, map[string]string{"missing": "x"}) {
+		t.Error("matchesTXTFilters with a missing key = true, want false")
+	}
+}
+
+func TestDedupeDiscovered(t *testing.T) {
+	explicit := []HostConfig{
+		{User: "root", Hostname: "10.0.0.1", Port: 22},
+	}
+	discovered := []HostConfig{
+		{User: "root", Hostname: "10.0.0.1", Port: 22}, // already explicit
+		{User: "root", Hostname: "10.0.0.2", Port: 22},
+		{User: "root", Hostname: "10.0.0.2", Port: 22}, // duplicate within discovered itself
+	}
+
+	out := dedupeDiscovered(explicit, discovered)
+	if len(out) != 1 {
+		t.Fatalf("got %d hosts, want 1: %+v", len(out), out)
+	}
+	if out[0].Hostname != "10.0.0.2" {
+		t.Errorf("out[0].Hostname = %q, want 10.0.0.2", out[0].Hostname)
+	}
+}
@@ -2,13 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/user"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,20 +20,55 @@ import (
 // HostConfig  holds the configuration for a host.
 type HostConfig struct {
 	Hostname       string
+	User           string
 	PrivateKeyPath string
-	Port           int
+	// IdentityPaths are the private keys to try, in order; set via one or
+	// more --identity flags. Falls back to []string{PrivateKeyPath} when
+	// empty.
+	IdentityPaths []string
+	// AuthOrder is the preference order for SSH auth methods, e.g.
+	// []string{"agent", "key", "password"}. See --auth-order.
+	AuthOrder []string
+	Port      int
+
+	// SSHConfigPath overrides which ssh_config file is consulted for this
+	// host; empty means ~/.ssh/config.
+	SSHConfigPath string
+	// KnownHostsFile is the known_hosts file used for host-key verification.
+	KnownHostsFile string
+	// StrictHostKeyChecking is "yes", "no", or "ask" (TOFU). See
+	// hostKeyCallback for the semantics of each mode.
+	StrictHostKeyChecking string
+
+	// Bastions, when non-empty, is the chain of jump hosts to dial through
+	// to reach Hostname, outermost first. See --bastion.
+	Bastions []HostConfig
+
+	// ConnectTimeout bounds the initial SSH dial; set from the global
+	// --connect-timeout flag once host parsing is done.
+	ConnectTimeout time.Duration
+
+	// Collectors restricts which Collector.Name() categories run, e.g.
+	// []string{"packages", "network"}; nil/empty means run everything that
+	// Detects true. Set from the global --collectors flag.
+	Collectors []string
 }
 
-type DebianSystemDetails struct {
-	Timestamp        time.Time     `json:"timestamp"`
-	DebianVersion    string        `json:"debian_version"`
-	Architecture     string        `json:"architecture"`
-	KernelVersion    string        `json:"kernel_version"`
-	InstalledModules []string      `json:"installed_modules"`
-	NetworkConfig    NetworkConfig `json:"network_config"`
-	// Plus any existing fields...
-	SystemdUnits []SystemdUnit  `json:"units"`     // Adjust this field name if different
-	Libraries    []InstalledLib `json:"libraries"` // Adjust this field name if different
+// SystemDetails is what gets serialized to json/<host>/<user>_<ts>.json. Only
+// the collectors that actually ran for this host (see --collectors and
+// Collector.Detect) show up under Collectors; everything else is identity
+// info gathered the same way regardless of OS.
+type SystemDetails struct {
+	Timestamp     time.Time `json:"timestamp"`
+	OSFamily      string    `json:"os_family"`
+	DistroID      string    `json:"distro_id"`
+	Architecture  string    `json:"architecture"`
+	KernelVersion string    `json:"kernel_version"`
+
+	// Collectors is keyed by Collector.Name() ("packages", "services",
+	// "network", "modules"), each value being whatever that collector
+	// returned (e.g. []InstalledLib, []SystemdUnit, NetworkConfig).
+	Collectors map[string]any `json:"collectors"`
 }
 
 type NetworkConfig struct {
@@ -56,24 +92,83 @@ type InstalledLib struct {
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: meikkalainen [user@hostname --private-key path/to/key]...")
+		fmt.Println("Usage: meikkalainen [--concurrency N] [--timeout dur] [--connect-timeout dur] [--discover svc] [user@hostname --private-key path/to/key]...")
+		fmt.Println("       meikkalainen discover [--discover svc] [--discover-filter re] [--discover-timeout dur] [--discover-txt k=v]")
+		fmt.Println("       meikkalainen diff <host> [--from ts] [--to ts] [--format text|json|markdown] [--fail-on pkg-removed,unit-failed]")
 		os.Exit(1)
 	}
 
-	hostConfigs, err := parseHostConfigs(os.Args[1:])
+	if os.Args[1] == "discover" {
+		runDiscoverCommand(os.Args[2:])
+		return
+	}
+
+	if os.Args[1] == "diff" {
+		runDiffCommand(os.Args[2:])
+		return
+	}
+
+	discoverCfg, rest, err := parseDiscoverFlags(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error parsing discover flags: %v", err)
+	}
+
+	globalCfg, rest, err := parseGlobalFlags(rest)
+	if err != nil {
+		log.Fatalf("Error parsing global flags: %v", err)
+	}
+
+	hostConfigs, err := parseHostConfigs(rest)
 	if err != nil {
 		log.Fatalf("Error parsing arguments: %v", err)
 	}
 
-	for _, config := range hostConfigs {
-		handleHost(config) // Pass the whole config to handleHost
+	if discoverCfg.ServiceType != "" {
+		discovered, err := discoverHosts(discoverCfg)
+		if err != nil {
+			log.Fatalf("Discovery failed: %v", err)
+		}
+		hostConfigs = append(hostConfigs, dedupeDiscovered(hostConfigs, discovered)...)
+	}
+
+	for i := range hostConfigs {
+		hostConfigs[i].ConnectTimeout = globalCfg.ConnectTimeout
+		hostConfigs[i].Collectors = globalCfg.Collectors
+	}
+
+	results := runHosts(hostConfigs, globalCfg)
+	printSummary(results)
+
+	for _, r := range results {
+		if r.Err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// Defaults shared by every HostConfig, however it was produced -- parsed
+// from the CLI, resolved from ~/.ssh/config, or synthesized by
+// discoverHosts -- so they all end up with a usable auth method.
+const (
+	defaultPrivateKeyPath        = "/default/path/to/private/key"
+	defaultPort                  = 22
+	defaultStrictHostKeyChecking = "ask"
+)
+
+// applyAuthDefaults fills in IdentityPaths and AuthOrder when unset. It's
+// the last step of the host-config pipeline, run after ssh_config
+// resolution (applySSHConfig) so PrivateKeyPath is already settled.
+func applyAuthDefaults(config *HostConfig) {
+	if len(config.IdentityPaths) == 0 {
+		config.IdentityPaths = []string{config.PrivateKeyPath}
+	}
+	if len(config.AuthOrder) == 0 {
+		config.AuthOrder = []string{"agent", "key"}
 	}
 }
 
 func parseHostConfigs(args []string) ([]HostConfig, error) {
 	var hostConfigs []HostConfig
-	defaultPrivateKeyPath := "/default/path/to/private/key"
-	defaultPort := 22 // Default SSH port
 
 	for i := 0; i < len(args); i++ {
 		if strings.HasPrefix(args[i], "--") {
@@ -81,7 +176,8 @@ func parseHostConfigs(args []string) ([]HostConfig, error) {
 			continue
 		}
 
-		config := HostConfig{Hostname: args[i], PrivateKeyPath: defaultPrivateKeyPath, Port: defaultPort}
+		config := HostConfig{Hostname: args[i], StrictHostKeyChecking: defaultStrictHostKeyChecking}
+		var bastionSpec, bastionKeyPath string
 
 		// Look ahead for flags related to this host
 		for i+1 < len(args) && strings.HasPrefix(args[i+1], "--") {
@@ -104,129 +200,155 @@ func parseHostConfigs(args []string) ([]HostConfig, error) {
 				} else {
 					return nil, fmt.Errorf("--port flag without a value")
 				}
+			case "--ssh-config":
+				if i+2 < len(args) {
+					config.SSHConfigPath = args[i+2]
+					i += 2
+				} else {
+					return nil, fmt.Errorf("--ssh-config flag without a value")
+				}
+			case "--identity":
+				if i+2 < len(args) {
+					config.IdentityPaths = append(config.IdentityPaths, args[i+2])
+					i += 2
+				} else {
+					return nil, fmt.Errorf("--identity flag without a value")
+				}
+			case "--auth-order":
+				if i+2 < len(args) {
+					order, err := parseAuthOrder(args[i+2])
+					if err != nil {
+						return nil, err
+					}
+					config.AuthOrder = order
+					i += 2
+				} else {
+					return nil, fmt.Errorf("--auth-order flag without a value")
+				}
+			case "--strict-host-key-checking":
+				if i+2 < len(args) {
+					mode := args[i+2]
+					if !validStrictHostKeyCheckingMode(mode) {
+						return nil, fmt.Errorf("--strict-host-key-checking flag with invalid value %s", mode)
+					}
+					config.StrictHostKeyChecking = mode
+					i += 2
+				} else {
+					return nil, fmt.Errorf("--strict-host-key-checking flag without a value")
+				}
+			case "--bastion":
+				if i+2 < len(args) {
+					bastionSpec = args[i+2]
+					i += 2
+				} else {
+					return nil, fmt.Errorf("--bastion flag without a value")
+				}
+			case "--bastion-key":
+				if i+2 < len(args) {
+					bastionKeyPath = args[i+2]
+					i += 2
+				} else {
+					return nil, fmt.Errorf("--bastion-key flag without a value")
+				}
 			}
 		}
 
-		hostConfigs = append(hostConfigs, config)
-	}
-
-	return hostConfigs, nil
-}
+		// Split "user@alias" so the ssh_config lookup below and the explicit
+		// CLI user agree on what's being resolved.
+		alias := config.Hostname
+		if parts := strings.SplitN(config.Hostname, "@", 2); len(parts) == 2 {
+			config.User = parts[0]
+			alias = parts[1]
+		}
 
-func handleHost(config HostConfig) {
-	fmt.Printf("Handling host: %s with private key: %s\n", config.Hostname, config.PrivateKeyPath)
+		sshConfigPath := config.SSHConfigPath
+		if sshConfigPath == "" {
+			sshConfigPath = defaultSSHConfigPath()
+		}
+		sshCfg, err := loadSSHConfig(sshConfigPath)
+		if err != nil {
+			return nil, err
+		}
 
-	// Split the host identifier into username and hostname.
-	parts := strings.SplitN(config.Hostname, "@", 2)
-	if len(parts) != 2 {
-		fmt.Println("Invalid host format. Expected user@hostname.")
-		return
-	}
-	user, hostname := parts[0], parts[1]
+		config.Hostname = ""
+		applySSHConfig(&config, alias, sshCfg, defaultPrivateKeyPath, defaultPort)
 
-	// Set up the SSH client configuration using the provided private key.
-	sshConfig, err := sshClientConfig(user, config.PrivateKeyPath)
-	if err != nil {
-		fmt.Printf("Failed to set up SSH config for host %s: %v\n", config.Hostname, err)
-		return
-	}
+		if config.User == "" {
+			current, err := user.Current()
+			if err != nil || current.Username == "" {
+				return nil, fmt.Errorf("no user specified for host %s: use user@host, an ssh_config User directive, or run as a user with a resolvable username", alias)
+			}
+			config.User = current.Username
+		}
 
-	// Format the address with the port
-	address := fmt.Sprintf("%s:%d", hostname, config.Port)
+		applyAuthDefaults(&config)
 
-	// Connect to the SSH server using the address with the specified port
-	client, err := ssh.Dial("tcp", address, sshConfig)
-	if err != nil {
-		fmt.Printf("Failed to dial SSH for host %s: %v\n", config.Hostname, err)
-		return
-	}
-	defer client.Close()
+		if bastionSpec != "" {
+			bastions, err := parseBastionSpec(bastionSpec, bastionKeyPath, config)
+			if err != nil {
+				return nil, err
+			}
+			config.Bastions = bastions
+		}
 
-	// Use the client to fetch data.
-	details, err := fetchData(client)
-	if err != nil {
-		fmt.Printf("Failed to fetch data for host %s: %v\n", config.Hostname, err)
-		return
+		hostConfigs = append(hostConfigs, config)
 	}
 
-	// Serialize details to JSON and save.
-	if err := saveDetailsAsJSON(hostname, user, details); err != nil {
-		fmt.Printf("Failed to save data for host %s: %v\n", config.Hostname, err)
-	}
+	return hostConfigs, nil
 }
 
-func fetchData(client *ssh.Client) (*DebianSystemDetails, error) {
-	// Initialize the details structure with the current timestamp.
-	details := DebianSystemDetails{
-		Timestamp: time.Now(),
+// handleHost collects from a single host and returns its result; it never
+// panics or calls os.Exit so it's safe to run from the runHosts worker pool.
+func handleHost(ctx context.Context, config HostConfig) hostResult {
+	start := time.Now()
+	hlog := logger.With("host", config.Hostname, "user", config.User)
+	result := func(err error) hostResult {
+		return hostResult{Host: config.Hostname, User: config.User, Err: err, Duration: time.Since(start)}
 	}
 
-	var err error
-	// Fetch Debian version.
-	details.DebianVersion, err = executeCommand(client, "cat /etc/debian_version")
-	if err != nil {
-		return nil, fmt.Errorf("error fetching Debian version: %w", err)
-	}
+	hlog.Info("collecting", "private_key", config.PrivateKeyPath)
 
-	// Fetch architecture
-	architecture, err := executeCommand(client, "uname -m")
-	if err != nil {
-		return nil, fmt.Errorf("error fetching architecture: %w", err)
-	}
-	details.Architecture = strings.TrimSpace(architecture)
-
-	// Fetch kernel version
-	kernelVersion, err := executeCommand(client, "uname -r")
-	if err != nil {
-		return nil, fmt.Errorf("error fetching kernel version: %w", err)
-	}
-	details.KernelVersion = strings.TrimSpace(kernelVersion)
-
-	// Fetch installed kernel modules
-	installedModulesOutput, err := executeCommand(client, "lsmod")
+	// Set up the SSH client configuration using the provided private key.
+	sshConfig, err := sshClientConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching installed kernel modules: %w", err)
+		hlog.Error("failed to set up SSH config", "err", err)
+		return result(fmt.Errorf("failed to set up SSH config: %w", err))
 	}
-	details.InstalledModules = parseLsmodOutput(installedModulesOutput)
-	sort.Strings(details.InstalledModules)
-
-	// Fetch network configuration
-	ipAddressesOutput, err := executeCommand(client, "hostname -I")
-	if err != nil {
-		return nil, fmt.Errorf("error fetching IP addresses: %w", err)
+	if config.ConnectTimeout > 0 {
+		sshConfig.Timeout = config.ConnectTimeout
 	}
-	details.NetworkConfig.IPAddresses = strings.Fields(strings.TrimSpace(ipAddressesOutput))
 
-	interfacesOutput, err := executeCommand(client, "ls /sys/class/net")
-	if err != nil {
-		return nil, fmt.Errorf("error fetching network interfaces: %w", err)
-	}
-	details.NetworkConfig.Interfaces = strings.Fields(strings.TrimSpace(interfacesOutput))
+	// Format the address with the port
+	address := fmt.Sprintf("%s:%d", config.Hostname, config.Port)
 
-	routingInfoOutput, err := executeCommand(client, "ip route")
+	// Connect to the SSH server, through any configured bastions, using the
+	// address with the specified port.
+	client, bastionClients, err := dialViaBastions(config, address, sshConfig)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching routing information: %w", err)
+		hlog.Error("failed to dial SSH", "err", err)
+		return result(fmt.Errorf("failed to dial SSH: %w", err))
 	}
-	details.NetworkConfig.RoutingInfo = strings.TrimSpace(routingInfoOutput)
+	defer client.Close()
+	defer closeHopClients(bastionClients)
 
-	// Fetch systemd unit states.
-	unitOutput, err := executeCommand(client, "systemctl list-units --output=export | tail -n +2 | sort")
+	// Use the client to fetch data.
+	details, err := fetchData(ctx, client, config.Collectors, hlog)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching systemd unit states: %w", err)
+		hlog.Error("failed to fetch data", "err", err)
+		return result(fmt.Errorf("failed to fetch data: %w", err))
 	}
-	details.SystemdUnits = parseSystemdOutput(unitOutput)
 
-	// Fetch installed libraries with dpkg.
-	libOutput, err := executeCommand(client, "dpkg-query --show")
-	if err != nil {
-		return nil, fmt.Errorf("error fetching installed libraries: %w", err)
+	// Serialize details to JSON and save.
+	if err := saveDetailsAsJSON(config.Hostname, config.User, details); err != nil {
+		hlog.Error("failed to save data", "err", err)
+		return result(fmt.Errorf("failed to save data: %w", err))
 	}
-	details.Libraries = parseDpkgOutput(libOutput)
 
-	return &details, nil
+	hlog.Info("collected", "duration", time.Since(start))
+	return result(nil)
 }
 
-func saveDetailsAsJSON(hostname, user string, details *DebianSystemDetails) error {
+func saveDetailsAsJSON(hostname, user string, details *SystemDetails) error {
 	jsonData, err := json.MarshalIndent(details, "", "    ")
 	if err != nil {
 		return fmt.Errorf("failed to serialize data: %w", err)
@@ -244,26 +366,24 @@ func saveDetailsAsJSON(hostname, user string, details *DebianSystemDetails) erro
 	return nil
 }
 
-func sshClientConfig(user, privateKeyPath string) (*ssh.ClientConfig, error) {
-	key, err := ioutil.ReadFile(privateKeyPath)
+func sshClientConfig(hc HostConfig) (*ssh.ClientConfig, error) {
+	authMethods, err := authMethodsFor(hc)
 	if err != nil {
 		return nil, err
 	}
 
-	signer, err := ssh.ParsePrivateKey(key)
+	hostKeyCb, err := hostKeyCallback(hc.KnownHostsFile, hc.StrictHostKeyChecking)
 	if err != nil {
 		return nil, err
 	}
 
 	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Matches StrictHostKeyChecking=no and UserKnownHostsFile=/dev/null
+		User:            hc.User,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCb,
 		BannerCallback:  ssh.BannerDisplayStderr(),
 		ClientVersion:   "SSH-2.0-OpenSSH_7.9", // Example, adjust as needed
-		Timeout:         0,                     // Consider setting a timeout
+		Timeout:         0,                     // Set from --connect-timeout in handleHost
 	}
 
 	// Note: Go's SSH package doesn't expose options equivalent to IdentitiesOnly, LogLevel, PubkeyAcceptedKeyTypes, and HostKeyAlgorithms directly.
@@ -272,8 +392,10 @@ func sshClientConfig(user, privateKeyPath string) (*ssh.ClientConfig, error) {
 	return config, nil
 }
 
-// executeCommand executes a shell command on the remote system using the provided ssh.Client and returns the output.
-func executeCommand(client *ssh.Client, command string) (string, error) {
+// executeCommand executes a shell command on the remote system using the
+// provided ssh.Client and returns the output. It aborts the session early if
+// ctx is canceled before the command finishes.
+func executeCommand(ctx context.Context, client *ssh.Client, command string) (string, error) {
 	session, err := client.NewSession()
 	if err != nil {
 		return "", fmt.Errorf("failed to create session: %w", err)
@@ -282,12 +404,23 @@ func executeCommand(client *ssh.Client, command string) (string, error) {
 
 	var stdoutBuf bytes.Buffer
 	session.Stdout = &stdoutBuf
-	err = session.Run(command)
-	if err != nil {
-		return "", fmt.Errorf("failed to run command '%s': %w", command, err)
+	if err := session.Start(command); err != nil {
+		return "", fmt.Errorf("failed to start command '%s': %w", command, err)
 	}
 
-	return stdoutBuf.String(), nil
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	select {
+	case <-ctx.Done():
+		session.Close()
+		return "", fmt.Errorf("command '%s' canceled: %w", command, ctx.Err())
+	case err := <-done:
+		if err != nil {
+			return "", fmt.Errorf("failed to run command '%s': %w", command, err)
+		}
+		return stdoutBuf.String(), nil
+	}
 }
 
 func parseLsmodOutput(output string) []string {
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultSSHConfigPath returns the user's ~/.ssh/config path, or "" if the
+// home directory can't be determined.
+func defaultSSHConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "config")
+}
+
+// defaultKnownHostsPath returns the user's ~/.ssh/known_hosts path, or "" if
+// the home directory can't be determined.
+func defaultKnownHostsPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// loadSSHConfig parses the ssh_config file at path. A missing file is not an
+// error; callers just get an empty config and every lookup falls through to
+// the CLI flags and defaults. A file the library can't fully parse (e.g. one
+// using a Match block, which ssh_config.Decode doesn't support) degrades the
+// same way: we log a warning and fall through, rather than aborting the
+// whole run over one host's config.
+func loadSSHConfig(path string) (*ssh_config.Config, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open ssh config %s: %w", path, err)
+	}
+	defer f.Close()
+
+	cfg, err := ssh_config.Decode(f)
+	if err != nil {
+		logger.Warn("failed to parse ssh config, falling back to CLI flags and defaults", "path", path, "err", err)
+		return nil, nil
+	}
+	return cfg, nil
+}
+
+// applySSHConfig fills in any zero-valued fields on config from the resolved
+// ssh_config alias entry, falling back to defaultPrivateKeyPath/defaultPort
+// only once every other source has been consulted.
+func applySSHConfig(config *HostConfig, alias string, cfg *ssh_config.Config, defaultPrivateKeyPath string, defaultPort int) {
+	get := func(key string) string {
+		if cfg == nil {
+			return ""
+		}
+		val, err := cfg.Get(alias, key)
+		if err != nil {
+			return ""
+		}
+		return val
+	}
+
+	if config.Hostname == "" || config.Hostname == alias {
+		if hn := get("HostName"); hn != "" {
+			config.Hostname = hn
+		} else if config.Hostname == "" {
+			config.Hostname = alias
+		}
+	}
+
+	if config.User == "" {
+		if u := get("User"); u != "" {
+			config.User = u
+		}
+	}
+
+	if config.Port == 0 {
+		if p := get("Port"); p != "" {
+			if port, err := strconv.Atoi(p); err == nil {
+				config.Port = port
+			}
+		}
+		if config.Port == 0 {
+			config.Port = defaultPort
+		}
+	}
+
+	if config.PrivateKeyPath == "" {
+		if id := get("IdentityFile"); id != "" {
+			config.PrivateKeyPath = expandHome(id)
+		} else {
+			config.PrivateKeyPath = defaultPrivateKeyPath
+		}
+	}
+
+	if config.KnownHostsFile == "" {
+		if kh := get("UserKnownHostsFile"); kh != "" {
+			// UserKnownHostsFile can list multiple space-separated paths; we
+			// only care about the first for host-key verification.
+			config.KnownHostsFile = expandHome(strings.Fields(kh)[0])
+		} else {
+			config.KnownHostsFile = defaultKnownHostsPath()
+		}
+	}
+}
+
+// expandHome expands a leading "~" in path to the current user's home
+// directory, mirroring how OpenSSH expands IdentityFile/UserKnownHostsFile.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// hostKeyCallback builds a ssh.HostKeyCallback for the given known_hosts file
+// and strictness mode:
+//
+//   - "yes": unknown or mismatched keys are always rejected.
+//   - "no":  host keys are never verified (equivalent to the old
+//     InsecureIgnoreHostKey behavior).
+//   - "ask": trust-on-first-use -- unknown hosts are logged and their key is
+//     appended to the known_hosts file; mismatched keys are still rejected.
+func hostKeyCallback(knownHostsFile, mode string) (ssh.HostKeyCallback, error) {
+	switch mode {
+	case "no":
+		return ssh.InsecureIgnoreHostKey(), nil
+	case "yes", "ask":
+		if knownHostsFile == "" {
+			return nil, fmt.Errorf("no known_hosts file available for strict-host-key-checking=%s", mode)
+		}
+		if err := ensureKnownHostsFile(knownHostsFile); err != nil {
+			return nil, err
+		}
+		base, err := knownhosts.New(knownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts %s: %w", knownHostsFile, err)
+		}
+		if mode == "yes" {
+			return base, nil
+		}
+		return tofuHostKeyCallback(knownHostsFile, base), nil
+	default:
+		return nil, fmt.Errorf("unknown --strict-host-key-checking mode %q (want yes, no, or ask)", mode)
+	}
+}
+
+// tofuHostKeyCallback wraps base so that a host missing from known_hosts is
+// accepted and appended, while a host present with a different key is still
+// rejected by base.
+func tofuHostKeyCallback(knownHostsFile string, base ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := base(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+		var keyErr *knownhosts.KeyError
+		if !isKnownHostsKeyError(err, &keyErr) || len(keyErr.Want) > 0 {
+			// Either a real error, or a known host whose key changed: don't
+			// silently paper over a possible MITM.
+			return err
+		}
+
+		fmt.Printf("The authenticity of host '%s' can't be established; adding to %s (TOFU)\n", hostname, knownHostsFile)
+		f, openErr := os.OpenFile(knownHostsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if openErr != nil {
+			return fmt.Errorf("failed to open known_hosts for append: %w", openErr)
+		}
+		defer f.Close()
+
+		line := knownhosts.Line([]string{hostname}, key)
+		if _, writeErr := f.WriteString(line + "\n"); writeErr != nil {
+			return fmt.Errorf("failed to append to known_hosts: %w", writeErr)
+		}
+		return nil
+	}
+}
+
+// isKnownHostsKeyError reports whether err is a *knownhosts.KeyError and, if
+// so, stores it in out.
+func isKnownHostsKeyError(err error, out **knownhosts.KeyError) bool {
+	keyErr, ok := err.(*knownhosts.KeyError)
+	if ok {
+		*out = keyErr
+	}
+	return ok
+}
+
+// ensureKnownHostsFile makes sure path (and its parent directory) exist so
+// TOFU appends and knownhosts.New don't fail on a fresh ~/.ssh.
+func ensureKnownHostsFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create known_hosts %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// validStrictHostKeyCheckingMode reports whether mode is a value
+// --strict-host-key-checking accepts.
+func validStrictHostKeyCheckingMode(mode string) bool {
+	switch mode {
+	case "yes", "no", "ask":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/ssh_config"
+)
+
+func TestApplySSHConfig(t *testing.T) {
+	raw := `
+Host box
+	HostName 10.0.0.5
+	User deploy
+	Port 2222
+	IdentityFile ~/.ssh/box_key
+`
+	cfg, err := ssh_config.Decode(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to decode test ssh_config: %v", err)
+	}
+
+	t.Run("fills in unset fields from the alias entry", func(t *testing.T) {
+		config := HostConfig{Hostname: "box"}
+		applySSHConfig(&config, "box", cfg, "/default/key", 22)
+
+		if config.Hostname != "10.0.0.5" {
+			t.Errorf("Hostname = %q, want 10.0.0.5", config.Hostname)
+		}
+		if config.User != "deploy" {
+			t.Errorf("User = %q, want deploy", config.User)
+		}
+		if config.Port != 2222 {
+			t.Errorf("Port = %d, want 2222", config.Port)
+		}
+		if want := expandHome("~/.ssh/box_key"); config.PrivateKeyPath != want {
+			t.Errorf("PrivateKeyPath = %q, want %q", config.PrivateKeyPath, want)
+		}
+	})
+
+	t.Run("CLI-specified fields win over the alias entry", func(t *testing.T) {
+		config := HostConfig{Hostname: "box", User: "root", Port: 2200, PrivateKeyPath: "/explicit/key"}
+		applySSHConfig(&config, "box", cfg, "/default/key", 22)
+
+		if config.User != "root" {
+			t.Errorf("User = %q, want root (explicit value should not be overridden)", config.User)
+		}
+		if config.Port != 2200 {
+			t.Errorf("Port = %d, want 2200", config.Port)
+		}
+		if config.PrivateKeyPath != "/explicit/key" {
+			t.Errorf("PrivateKeyPath = %q, want /explicit/key", config.PrivateKeyPath)
+		}
+	})
+
+	t.Run("falls back to defaults when nothing matches", func(t *testing.T) {
+		config := HostConfig{Hostname: "unknown-alias"}
+		applySSHConfig(&config, "unknown-alias", cfg, "/default/key", 22)
+
+		if config.Port != 22 {
+			t.Errorf("Port = %d, want default 22", config.Port)
+		}
+		if config.PrivateKeyPath != "/default/key" {
+			t.Errorf("PrivateKeyPath = %q, want default /default/key", config.PrivateKeyPath)
+		}
+	})
+
+	t.Run("nil ssh_config falls straight through to defaults", func(t *testing.T) {
+		config := HostConfig{Hostname: "box"}
+		applySSHConfig(&config, "box", nil, "/default/key", 22)
+
+		if config.Hostname != "box" {
+			t.Errorf("Hostname = %q, want box unchanged", config.Hostname)
+		}
+		if config.Port != 22 {
+			t.Errorf("Port = %d, want default 22", config.Port)
+		}
+	})
+}
+
+func TestExpandHome(t *testing.T) {
+	if got := expandHome("/absolute/path"); got != "/absolute/path" {
+		t.Errorf("expandHome(%q) = %q, want unchanged", "/absolute/path", got)
+	}
+
+	got := expandHome("~/.ssh/id_ed25519")
+	if strings.HasPrefix(got, "~") {
+		t.Errorf("expandHome(%q) = %q, want leading ~ expanded", "~/.ssh/id_ed25519", got)
+	}
+	if !strings.HasSuffix(got, "/.ssh/id_ed25519") {
+		t.Errorf("expandHome(%q) = %q, want suffix /.ssh/id_ed25519", "~/.ssh/id_ed25519", got)
+	}
+}
+
+func TestValidStrictHostKeyCheckingMode(t *testing.T) {
+	for _, mode := range []string{"yes", "no", "ask"} {
+		if !validStrictHostKeyCheckingMode(mode) {
+			t.Errorf("validStrictHostKeyCheckingMode(%q) = false, want true", mode)
+		}
+	}
+	if validStrictHostKeyCheckingMode("maybe") {
+		t.Errorf("validStrictHostKeyCheckingMode(%q) = true, want false", "maybe")
+	}
+}